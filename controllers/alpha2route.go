@@ -0,0 +1,260 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"gitee.com/zongzw/bigip-kubernetes-gateway/pkg"
+	"gitee.com/zongzw/f5-bigip-rest/utils"
+	"github.com/google/uuid"
+	"k8s.io/apimachinery/pkg/api/meta"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+)
+
+// alpha2RouteKind is what differs between the reconcilers of the v1alpha2
+// routes, which are deployed the same way: the gateways referred by the route
+// are parsed before and after the route is changed in the cache.
+type alpha2RouteKind struct {
+	// kind is the Kind of the route, e.g. "TLSRoute".
+	kind string
+	// newObject returns an empty route to read into.
+	newObject func() client.Object
+	// get returns the route in the cache, or nil.
+	get         func(keyname string) client.Object
+	set         func(obj client.Object)
+	unset       func(keyname string)
+	gatewayRefs func(obj client.Object) []*gatewayv1beta1.Gateway
+	// updateStatus writes the parents' status of the route.
+	updateStatus func(ctx context.Context, c client.Client, keyname string)
+}
+
+// reconcileAlpha2Route is the Reconcile of the v1alpha2 route reconcilers.
+func reconcileAlpha2Route(ctx context.Context, c client.Client, feedback *deployFeedback, rk *alpha2RouteKind,
+	req ctrl.Request) (ctrl.Result, error) {
+
+	lctx := context.WithValue(ctx, utils.CtxKey_Logger, utils.NewLog(uuid.New().String(), "debug"))
+	slog := utils.LogFromContext(lctx)
+	if !pkg.ActiveSIGs.SyncedAtStart {
+		<-time.After(100 * time.Millisecond)
+		return ctrl.Result{Requeue: true}, nil
+	}
+	feedback.retry(lctx, req.NamespacedName.String())
+
+	obj := rk.newObject()
+
+	slog.Debugf("handling " + req.NamespacedName.String())
+	if err := c.Get(ctx, req.NamespacedName, obj); err != nil {
+		if client.IgnoreNotFound(err) == nil {
+			// delete resources
+			defer rk.unset(req.NamespacedName.String())
+			return handleDeletingAlpha2Route(lctx, c, feedback, rk, req)
+		} else {
+			return ctrl.Result{}, err
+		}
+	} else {
+		// upsert resources
+		defer rk.set(obj)
+		return handleUpsertingAlpha2Route(lctx, c, feedback, rk, obj)
+	}
+}
+
+// setupAlpha2RouteWithManager sets up the reconciler of the v1alpha2 route.
+// The route is experimental, the controller is skipped if its CRD is not installed.
+func setupAlpha2RouteWithManager(mgr ctrl.Manager, r reconcile.Reconciler, feedback **deployFeedback, rk *alpha2RouteKind) error {
+	if installed, err := experimentalKindInstalled(mgr, rk.kind); err != nil || !installed {
+		return err
+	}
+
+	*feedback = newDeployFeedback(mgr.GetEventRecorderFor(eventRecorderName))
+	return ctrl.NewControllerManagedBy(mgr).
+		For(rk.newObject()).
+		Watches((*feedback).source()).
+		Complete(r)
+}
+
+func handleDeletingAlpha2Route(ctx context.Context, c client.Client, feedback *deployFeedback, rk *alpha2RouteKind,
+	req ctrl.Request) (ctrl.Result, error) {
+
+	route := rk.get(req.NamespacedName.String())
+	if route == nil {
+		return ctrl.Result{}, nil
+	}
+	gws := rk.gatewayRefs(route)
+	drs := map[string]*pkg.DeployRequest{}
+	for _, gw := range gws {
+		if _, f := drs[string(gw.Spec.GatewayClassName)]; !f {
+			drs[string(gw.Spec.GatewayClassName)] = &pkg.DeployRequest{
+				Meta:      fmt.Sprintf("deleting %s '%s'", rk.lowerKind(), req.NamespacedName.String()),
+				Partition: pkg.ActiveSIGs.PartitionOfClass(string(gw.Spec.GatewayClassName)),
+			}
+		}
+		dr := drs[string(gw.Spec.GatewayClassName)]
+		if ocfgs, err := pkg.ParseGatewayRelatedForClass(string(gw.Spec.GatewayClassName), gws); err != nil {
+			return ctrl.Result{}, err
+		} else {
+			dr.From = &ocfgs
+		}
+	}
+
+	opcfgs, err := pkg.ParseServicesRelatedForAll()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	rk.unset(req.NamespacedName.String())
+
+	npcfgs, err := pkg.ParseServicesRelatedForAll()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	for _, gw := range gws {
+		dr := drs[string(gw.Spec.GatewayClassName)]
+		if ncfgs, err := pkg.ParseGatewayRelatedForClass(string(gw.Spec.GatewayClassName), gws); err != nil {
+			return ctrl.Result{}, err
+		} else {
+			dr.To = &ncfgs
+		}
+	}
+
+	for _, dr := range drs {
+		pkg.PendingDeploys <- pkg.DeployRequest{
+			Meta: dr.Meta,
+			From: dr.From,
+			To:   dr.To,
+			StatusFunc: func(err error) {
+				updateStatusForGateways(ctx, c, gatewayKeysOf(gws), err)
+				feedback.report(ctx, route, err)
+			},
+			Partition: dr.Partition,
+			Context:   ctx,
+		}
+	}
+
+	deployServices(ctx, fmt.Sprintf("updating services for deleting %s '%s'", rk.lowerKind(), req.NamespacedName.String()),
+		opcfgs, npcfgs, func(err error) {
+			feedback.report(ctx, route, err)
+		})
+
+	return ctrl.Result{}, nil
+}
+
+func handleUpsertingAlpha2Route(ctx context.Context, c client.Client, feedback *deployFeedback, rk *alpha2RouteKind,
+	obj client.Object) (ctrl.Result, error) {
+
+	slog := utils.LogFromContext(ctx)
+	reqnsn := utils.Keyname(obj.GetNamespace(), obj.GetName())
+	slog.Debugf("upserting " + reqnsn)
+
+	gws := []*gatewayv1beta1.Gateway{}
+	if route := rk.get(reqnsn); route != nil {
+		gws = rk.gatewayRefs(route)
+	}
+	drs := map[string]*pkg.DeployRequest{}
+
+	for _, gw := range gws {
+		if _, f := drs[string(gw.Spec.GatewayClassName)]; !f {
+			drs[string(gw.Spec.GatewayClassName)] = &pkg.DeployRequest{
+				Meta:      fmt.Sprintf("upserting %s '%s'", rk.lowerKind(), reqnsn),
+				Partition: pkg.ActiveSIGs.PartitionOfClass(string(gw.Spec.GatewayClassName)),
+			}
+		}
+		dr := drs[string(gw.Spec.GatewayClassName)]
+		if ocfgs, err := pkg.ParseGatewayRelatedForClass(string(gw.Spec.GatewayClassName), gws); err != nil {
+			return ctrl.Result{}, err
+		} else {
+			dr.From = &ocfgs
+		}
+	}
+
+	opcfgs, err := pkg.ParseServicesRelatedForAll()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	rk.set(obj.DeepCopyObject().(client.Object))
+
+	npcfgs, err := pkg.ParseServicesRelatedForAll()
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// the gateways previously attached are parsed as well, or the route is left on them.
+	gws = unifiedGateways(append(gws, rk.gatewayRefs(obj.DeepCopyObject().(client.Object))...))
+
+	for _, gw := range gws {
+		if _, f := drs[string(gw.Spec.GatewayClassName)]; !f {
+			drs[string(gw.Spec.GatewayClassName)] = &pkg.DeployRequest{
+				Meta:      fmt.Sprintf("upserting %s '%s'", rk.lowerKind(), reqnsn),
+				Partition: pkg.ActiveSIGs.PartitionOfClass(string(gw.Spec.GatewayClassName)),
+			}
+		}
+		dr := drs[string(gw.Spec.GatewayClassName)]
+		if ncfgs, err := pkg.ParseGatewayRelatedForClass(string(gw.Spec.GatewayClassName), gws); err != nil {
+			return ctrl.Result{}, err
+		} else {
+			dr.To = &ncfgs
+		}
+	}
+
+	deployServices(ctx, fmt.Sprintf("updating services for upserting %s '%s'", rk.lowerKind(), reqnsn), opcfgs, npcfgs, func(err error) {
+		// the route may not be attached to any gateway, its status is written here as well.
+		rk.updateStatus(ctx, c, reqnsn)
+		feedback.report(ctx, obj, err)
+	})
+
+	for _, dr := range drs {
+		pkg.PendingDeploys <- pkg.DeployRequest{
+			Meta: dr.Meta,
+			From: dr.From,
+			To:   dr.To,
+			StatusFunc: func(err error) {
+				updateStatusForGateways(ctx, c, gatewayKeysOf(gws), err)
+				feedback.report(ctx, obj, err)
+			},
+			Partition: dr.Partition,
+			Context:   ctx,
+		}
+	}
+
+	return ctrl.Result{}, nil
+}
+
+func (rk *alpha2RouteKind) lowerKind() string {
+	return strings.ToLower(rk.kind)
+}
+
+// experimentalKindInstalled tells whether the CRD of the v1alpha2 kind is installed.
+func experimentalKindInstalled(mgr ctrl.Manager, kind string) (bool, error) {
+	gvk := gatewayv1alpha2.SchemeGroupVersion.WithKind(kind)
+	if _, err := mgr.GetRESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+		if meta.IsNoMatchError(err) {
+			ctrl.Log.Info(fmt.Sprintf("%s CRD is not installed, skip the controller", kind))
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,242 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"gitee.com/zongzw/bigip-kubernetes-gateway/pkg"
+	"gitee.com/zongzw/f5-bigip-rest/utils"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+)
+
+// redeployGatewaysWithServices parses the gateways and all the services before
+// and after change, and deploys the difference. report is called with the
+// result of each deployment.
+func redeployGatewaysWithServices(ctx context.Context, c client.Client, gws []*gatewayv1beta1.Gateway,
+	meta string, change func(), report func(error)) error {
+
+	classes := map[string][]*gatewayv1beta1.Gateway{}
+	for _, gw := range gws {
+		className := string(gw.Spec.GatewayClassName)
+		classes[className] = append(classes[className], gw)
+	}
+
+	drs := map[string]*pkg.DeployRequest{}
+	for className, cgws := range classes {
+		drs[className] = &pkg.DeployRequest{
+			Meta:      meta,
+			Partition: pkg.ActiveSIGs.PartitionOfClass(className),
+		}
+		if ocfgs, err := pkg.ParseGatewayRelatedForClass(className, cgws); err != nil {
+			return err
+		} else {
+			drs[className].From = &ocfgs
+		}
+	}
+
+	opcfgs, err := pkg.ParseServicesRelatedForAll()
+	if err != nil {
+		return err
+	}
+
+	change()
+
+	npcfgs, err := pkg.ParseServicesRelatedForAll()
+	if err != nil {
+		return err
+	}
+
+	for className, cgws := range classes {
+		if ncfgs, err := pkg.ParseGatewayRelatedForClass(className, cgws); err != nil {
+			return err
+		} else {
+			drs[className].To = &ncfgs
+		}
+	}
+
+	// the pools are created before the rules refer to them, and removed after.
+	deployServices(ctx, fmt.Sprintf("updating services for %s", meta), opcfgs, npcfgs, report)
+
+	for className, dr := range drs {
+		cgws := classes[className]
+		pkg.PendingDeploys <- pkg.DeployRequest{
+			Meta: dr.Meta,
+			From: dr.From,
+			To:   dr.To,
+			StatusFunc: func(err error) {
+				updateStatusForGateways(ctx, c, gatewayKeysOf(cgws), err)
+				report(err)
+			},
+			Partition: dr.Partition,
+			Context:   ctx,
+		}
+	}
+
+	return nil
+}
+
+// redeployServiceKeys parses the pools of the services before and after change,
+// and deploys the difference.
+func redeployServiceKeys(ctx context.Context, svcKeys []string, meta string, change func(), report func(error)) error {
+	opcfgs, err := pkg.ParseReferedServiceKeys(svcKeys)
+	if err != nil {
+		return err
+	}
+
+	change()
+
+	npcfgs, err := pkg.ParseReferedServiceKeys(svcKeys)
+	if err != nil {
+		return err
+	}
+
+	deployServices(ctx, meta, opcfgs, npcfgs, report)
+	return nil
+}
+
+// redeployGatewayClasses parses the gateways of the classes and all the services
+// before and after change, and deploys the difference. The gateways of a class
+// are moved to the new partition if the partition of the class is changed.
+// With invalid parameters, the class is left as deployed and only its status is updated.
+// The pools are moved as well if the backend partition of a class is changed.
+func redeployGatewayClasses(ctx context.Context, c client.Client, classNames []string,
+	meta string, change func(), report func(error)) error {
+	slog := utils.LogFromContext(ctx)
+
+	ocfgs, opartitions := map[string]map[string]interface{}{}, map[string]string{}
+	for _, className := range classNames {
+		opartitions[className] = pkg.ActiveSIGs.PartitionOfClass(className)
+		gws := pkg.ActiveSIGs.AttachedGateways(pkg.ActiveSIGs.GetGatewayClass(className))
+		if cfgs, err := pkg.ParseGatewayRelatedForClass(className, gws); err != nil {
+			// the parameters were invalid, nothing was deployed with them.
+			slog.Debugf("no previous configs for class %s: %s", className, err.Error())
+			ocfgs[className] = map[string]interface{}{}
+		} else {
+			ocfgs[className] = cfgs
+		}
+	}
+	opcfgs, err := pkg.ParseServicesRelatedForAll()
+	if err != nil {
+		return err
+	}
+
+	change()
+
+	npcfgs, err := pkg.ParseServicesRelatedForAll()
+	if err != nil {
+		return err
+	}
+
+	// the pools of the backend partitions no longer used are removed after
+	// the gateways stop referring them.
+	unused := map[string]map[string]interface{}{}
+	for partition, cfgs := range opcfgs {
+		if _, ok := npcfgs[partition]; !ok {
+			unused[partition] = cfgs
+		}
+	}
+	kpcfgs := map[string]map[string]interface{}{}
+	for partition, cfgs := range npcfgs {
+		kpcfgs[partition] = cfgs
+	}
+	for partition, cfgs := range unused {
+		kpcfgs[partition] = cfgs
+	}
+	deployServices(ctx, fmt.Sprintf("refreshing services for %s", meta), opcfgs, kpcfgs, report)
+
+	for _, className := range classNames {
+		className := className
+		gws := pkg.ActiveSIGs.AttachedGateways(pkg.ActiveSIGs.GetGatewayClass(className))
+		ncfgs, err := pkg.ParseGatewayRelatedForClass(className, gws)
+		if err != nil {
+			slog.Errorf("unable to deploy gatewayclass %s: %s", className, err.Error())
+			updateGatewayClassStatus(ctx, c, className)
+			updateStatusForGateways(ctx, c, gatewayKeysOf(gws), nil)
+			continue
+		}
+
+		from, npartition := ocfgs[className], pkg.ActiveSIGs.PartitionOfClass(className)
+		if opartition := opartitions[className]; opartition != npartition {
+			dctx := context.WithValue(ctx, pkg.CtxKey_DeletePartition, "yes")
+			pkg.PendingDeploys <- pkg.DeployRequest{
+				Meta:       fmt.Sprintf("moving gateways of gatewayclass '%s' out of partition %s", className, opartition),
+				From:       &from,
+				To:         nil,
+				StatusFunc: report,
+				Partition:  opartition,
+				Context:    dctx,
+			}
+			from = map[string]interface{}{}
+		}
+
+		cctx := context.WithValue(ctx, pkg.CtxKey_CreatePartition, "yes")
+		pkg.PendingDeploys <- pkg.DeployRequest{
+			Meta: fmt.Sprintf("refreshing gateways of gatewayclass '%s' for %s", className, meta),
+			From: &from,
+			To:   &ncfgs,
+			StatusFunc: func(err error) {
+				updateGatewayClassStatus(ctx, c, className)
+				updateStatusForGateways(ctx, c, gatewayKeysOf(gws), err)
+				report(err)
+			},
+			Partition: npartition,
+			Context:   cctx,
+		}
+	}
+
+	deployServices(ctx, fmt.Sprintf("removing services for %s", meta), unused, nil, report)
+
+	return nil
+}
+
+// deployServices deploys the difference of the pools in each backend partition,
+// the backend partitions are created if not existing.
+func deployServices(ctx context.Context, meta string, opcfgs, npcfgs map[string]map[string]interface{}, report func(error)) {
+	partitions := []string{}
+	for partition := range opcfgs {
+		partitions = append(partitions, partition)
+	}
+	for partition := range npcfgs {
+		if _, ok := opcfgs[partition]; !ok {
+			partitions = append(partitions, partition)
+		}
+	}
+	sort.Strings(partitions)
+
+	cctx := context.WithValue(ctx, pkg.CtxKey_CreatePartition, "yes")
+	for _, partition := range partitions {
+		ocfgs, ncfgs := opcfgs[partition], npcfgs[partition]
+		if ocfgs == nil {
+			ocfgs = map[string]interface{}{}
+		}
+		if ncfgs == nil {
+			ncfgs = map[string]interface{}{}
+		}
+		pkg.PendingDeploys <- pkg.DeployRequest{
+			Meta:       meta,
+			From:       &ocfgs,
+			To:         &ncfgs,
+			StatusFunc: report,
+			Partition:  partition,
+			Context:    cctx,
+		}
+	}
+}
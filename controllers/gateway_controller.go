@@ -34,7 +34,8 @@ import (
 
 type GatewayReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	feedback *deployFeedback
 }
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
@@ -53,6 +54,8 @@ func (r *GatewayReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 		<-time.After(100 * time.Millisecond)
 		return ctrl.Result{Requeue: true}, nil
 	}
+	r.feedback.retry(lctx, req.NamespacedName.String())
+
 	var obj gatewayv1beta1.Gateway
 
 	slog.Debugf("handling " + req.NamespacedName.String())
@@ -60,33 +63,38 @@ func (r *GatewayReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 		if client.IgnoreNotFound(err) == nil {
 			// delete resources
 			defer pkg.ActiveSIGs.UnsetGateway(req.NamespacedName.String())
-			return handleDeletingGateway(lctx, req)
+			return handleDeletingGateway(lctx, r, req)
 		} else {
 			return ctrl.Result{}, err
 		}
 	} else {
 		// upsert resources
 		defer pkg.ActiveSIGs.SetGateway(&obj)
-		return handleUpsertingGateway(lctx, &obj)
+		return handleUpsertingGateway(lctx, r, &obj)
 	}
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *GatewayReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.feedback = newDeployFeedback(mgr.GetEventRecorderFor(eventRecorderName))
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&gatewayv1beta1.Gateway{}).
+		Watches(r.feedback.source()).
 		Complete(r)
 }
 
-func handleDeletingGateway(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func handleDeletingGateway(ctx context.Context, r *GatewayReconciler, req ctrl.Request) (ctrl.Result, error) {
 	slog := utils.LogFromContext(ctx)
 
 	gw := pkg.ActiveSIGs.GetGateway(req.NamespacedName.String())
+	if gw == nil {
+		return ctrl.Result{}, nil
+	}
 	// Only when we know all the gateways can we know exactly which routes need to be cleared because of this gateway event.
 	gws := pkg.ActiveSIGs.GetNeighborGateways(gw)
 
 	ocfgs, ncfgs := map[string]interface{}{}, map[string]interface{}{}
-	opcfgs, npcfgs := map[string]interface{}{}, map[string]interface{}{}
+	opcfgs, npcfgs := map[string]map[string]interface{}{}, map[string]map[string]interface{}{}
 	var err error
 
 	if ocfgs, err = pkg.ParseGatewayRelatedForClass(string(gw.Spec.GatewayClassName), append(gws, gw)); err != nil {
@@ -110,27 +118,21 @@ func handleDeletingGateway(ctx context.Context, req ctrl.Request) (ctrl.Result,
 		Meta: fmt.Sprintf("deleting gateway '%s'", req.NamespacedName.String()),
 		From: &ocfgs,
 		To:   &ncfgs,
-		StatusFunc: func() {
-			// do something
+		StatusFunc: func(err error) {
+			updateStatusForGateways(ctx, r.Client, gatewayKeysOf(append(gws, gw)), err)
+			r.feedback.report(ctx, gw, err)
 		},
-		Partition: string(gw.Spec.GatewayClassName),
+		Partition: pkg.ActiveSIGs.PartitionOfClass(string(gw.Spec.GatewayClassName)),
 		Context:   ctx,
 	}
 
-	pkg.PendingDeploys <- pkg.DeployRequest{
-		Meta: fmt.Sprintf("updating services for event '%s'", req.NamespacedName.String()),
-		From: &opcfgs,
-		To:   &npcfgs,
-		StatusFunc: func() {
-			// do something
-		},
-		Partition: "cis-c-tenant",
-		Context:   ctx,
-	}
+	deployServices(ctx, fmt.Sprintf("updating services for event '%s'", req.NamespacedName.String()), opcfgs, npcfgs, func(err error) {
+		r.feedback.report(ctx, gw, err)
+	})
 	return ctrl.Result{}, nil
 }
 
-func handleUpsertingGateway(ctx context.Context, obj *gatewayv1beta1.Gateway) (ctrl.Result, error) {
+func handleUpsertingGateway(ctx context.Context, r *GatewayReconciler, obj *gatewayv1beta1.Gateway) (ctrl.Result, error) {
 	slog := utils.LogFromContext(ctx)
 
 	reqnsn := utils.Keyname(obj.Namespace, obj.Name)
@@ -148,7 +150,7 @@ func handleUpsertingGateway(ctx context.Context, obj *gatewayv1beta1.Gateway) (c
 	if ngw.Spec.GatewayClassName == ogw.Spec.GatewayClassName {
 
 		ocfgs, ncfgs := map[string]interface{}{}, map[string]interface{}{}
-		opcfgs, npcfgs := map[string]interface{}{}, map[string]interface{}{}
+		opcfgs, npcfgs := map[string]map[string]interface{}{}, map[string]map[string]interface{}{}
 		ocfgs, err = pkg.ParseGatewayRelatedForClass(string(ogw.Spec.GatewayClassName), []*gatewayv1beta1.Gateway{ogw})
 		if err != nil {
 			slog.Errorf("handling + upserting + parse related ocfgs: %s %s", reqnsn, err.Error())
@@ -171,25 +173,19 @@ func handleUpsertingGateway(ctx context.Context, obj *gatewayv1beta1.Gateway) (c
 			return ctrl.Result{}, err
 		}
 
-		pkg.PendingDeploys <- pkg.DeployRequest{
-			Meta: fmt.Sprintf("upserting services for gateway '%s'", reqnsn),
-			From: &opcfgs,
-			To:   &npcfgs,
-			StatusFunc: func() {
-				// do something
-			},
-			Partition: "cis-c-tenant",
-			Context:   ctx,
-		}
+		deployServices(ctx, fmt.Sprintf("upserting services for gateway '%s'", reqnsn), opcfgs, npcfgs, func(err error) {
+			r.feedback.report(ctx, ngw, err)
+		})
 
 		pkg.PendingDeploys <- pkg.DeployRequest{
 			Meta: fmt.Sprintf("upserting gateway '%s'", reqnsn),
 			From: &ocfgs,
 			To:   &ncfgs,
-			StatusFunc: func() {
-				// do something
+			StatusFunc: func(err error) {
+				updateStatusForGateways(ctx, r.Client, []string{reqnsn}, err)
+				r.feedback.report(ctx, ngw, err)
 			},
-			Partition: string(ngw.Spec.GatewayClassName),
+			Partition: pkg.ActiveSIGs.PartitionOfClass(string(ngw.Spec.GatewayClassName)),
 			Context:   ctx,
 		}
 		return ctrl.Result{}, nil
@@ -197,7 +193,7 @@ func handleUpsertingGateway(ctx context.Context, obj *gatewayv1beta1.Gateway) (c
 	} else {
 		ocfgs1, ncfgs1 := map[string]interface{}{}, map[string]interface{}{} // for original class
 		ocfgs2, ncfgs2 := map[string]interface{}{}, map[string]interface{}{} // for target class
-		opcfgs, npcfgs := map[string]interface{}{}, map[string]interface{}{}
+		opcfgs, npcfgs := map[string]map[string]interface{}{}, map[string]map[string]interface{}{}
 
 		// gateway is go away
 		ngs := pkg.ActiveSIGs.GetNeighborGateways(ogw)
@@ -212,16 +208,9 @@ func handleUpsertingGateway(ctx context.Context, obj *gatewayv1beta1.Gateway) (c
 			return ctrl.Result{}, err
 		}
 
-		pkg.PendingDeploys <- pkg.DeployRequest{
-			Meta: fmt.Sprintf("upserting services for gateway '%s'", reqnsn),
-			From: &opcfgs,
-			To:   &npcfgs,
-			StatusFunc: func() {
-				// do something
-			},
-			Partition: "cis-c-tenant",
-			Context:   ctx,
-		}
+		deployServices(ctx, fmt.Sprintf("upserting services for gateway '%s'", reqnsn), opcfgs, npcfgs, func(err error) {
+			r.feedback.report(ctx, ngw, err)
+		})
 
 		ocfgs1, err = pkg.ParseGatewayRelatedForClass(string(ogw.Spec.GatewayClassName), append(ngs, ogw))
 		if err != nil {
@@ -235,10 +224,11 @@ func handleUpsertingGateway(ctx context.Context, obj *gatewayv1beta1.Gateway) (c
 			Meta: fmt.Sprintf("upserting gateway '%s'", reqnsn),
 			From: &ocfgs1,
 			To:   &ncfgs1,
-			StatusFunc: func() {
-				// do something
+			StatusFunc: func(err error) {
+				updateStatusForGateways(ctx, r.Client, gatewayKeysOf(ngs), err)
+				r.feedback.report(ctx, ngw, err)
 			},
-			Partition: string(ogw.Spec.GatewayClassName),
+			Partition: pkg.ActiveSIGs.PartitionOfClass(string(ogw.Spec.GatewayClassName)),
 			Context:   ctx,
 		}
 
@@ -255,10 +245,11 @@ func handleUpsertingGateway(ctx context.Context, obj *gatewayv1beta1.Gateway) (c
 			Meta: fmt.Sprintf("upserting gateway '%s'", reqnsn),
 			From: &ocfgs2,
 			To:   &ncfgs2,
-			StatusFunc: func() {
-				// do something
+			StatusFunc: func(err error) {
+				updateStatusForGateways(ctx, r.Client, []string{reqnsn}, err)
+				r.feedback.report(ctx, ngw, err)
 			},
-			Partition: string(ngw.Spec.GatewayClassName),
+			Partition: pkg.ActiveSIGs.PartitionOfClass(string(ngw.Spec.GatewayClassName)),
 			Context:   ctx,
 		}
 
@@ -28,13 +28,13 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
 )
 
 type GatewayClassReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	feedback *deployFeedback
 }
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
@@ -58,52 +58,34 @@ func (r *GatewayClassReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		return ctrl.Result{Requeue: true}, nil
 	}
 
+	r.feedback.retry(lctx, req.NamespacedName.String())
+
 	var obj gatewayv1beta1.GatewayClass
 	slog.Debugf("handling gatewayclass " + req.Name)
 	if err := r.Get(ctx, req.NamespacedName, &obj); err != nil {
 		if client.IgnoreNotFound(err) == nil {
 			defer pkg.ActiveSIGs.UnsetGatewayClass(req.Name)
-			return handleDeletingGatewayClass(lctx, req)
+			return handleDeletingGatewayClass(lctx, r, req)
 		} else {
 			return ctrl.Result{}, err
 		}
 	} else {
-		ngwc := obj.DeepCopy()
-
-		ngwc.Status.Conditions = []metav1.Condition{
-			{
-				Type:               "Accepted",
-				Status:             metav1.ConditionTrue,
-				Reason:             string(gatewayv1beta1.GatewayClassReasonAccepted),
-				Message:            "Accepted message",
-				LastTransitionTime: metav1.NewTime(time.Now()),
-			},
-		}
-
-		// TODO:
-		// 1.671457016981118e+09	DEBUG	handling gatewayclass bigip	{"controller": "gatewayclass", "controllerGroup": "gateway.networking.k8s.io", "controllerKind": "GatewayClass", "GatewayClass": {"name":"bigip"}, "namespace": "", "name": "bigip", "reconcileID": "bcd01fdd-8dfc-4be9-b3ab-c3d3a3fdb67e"}
-		// 1.6714570170091689e+09	ERROR	unable to update status	{"controller": "gatewayclass", "controllerGroup": "gateway.networking.k8s.io", "controllerKind": "GatewayClass", "GatewayClass": {"name":"bigip"}, "namespace": "", "name": "bigip", "reconcileID": "bcd01fdd-8dfc-4be9-b3ab-c3d3a3fdb67e", "error": "Operation cannot be fulfilled on gatewayclasses.gateway.networking.k8s.io \"bigip\": the object has been modified; please apply your changes to the latest version and try again"}
-		if err := r.Status().Update(ctx, ngwc); err != nil {
-			slog.Errorf("unable to update status: %s", err.Error())
-			return ctrl.Result{}, err
-		} else {
-			slog.Debugf("status updated")
-		}
-
 		// upsert gatewayclass
 		defer pkg.ActiveSIGs.SetGatewayClass(&obj)
-		return handleUpsertingGatewayClass(lctx, &obj)
+		return handleUpsertingGatewayClass(lctx, r, &obj)
 	}
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *GatewayClassReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.feedback = newDeployFeedback(mgr.GetEventRecorderFor(eventRecorderName))
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&gatewayv1beta1.GatewayClass{}).
+		Watches(r.feedback.source()).
 		Complete(r)
 }
 
-func handleDeletingGatewayClass(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func handleDeletingGatewayClass(ctx context.Context, r *GatewayClassReconciler, req ctrl.Request) (ctrl.Result, error) {
 	slog := utils.LogFromContext(ctx)
 	slog.Debugf("deleting gatewayclass " + req.Name)
 
@@ -113,7 +95,7 @@ func handleDeletingGatewayClass(ctx context.Context, req ctrl.Request) (ctrl.Res
 	}
 	ocfgs := map[string]interface{}{}
 	// ocfgs, ncfgs := map[string]interface{}{}, map[string]interface{}{}
-	opcfgs, npcfgs := map[string]interface{}{}, map[string]interface{}{}
+	opcfgs, npcfgs := map[string]map[string]interface{}{}, map[string]map[string]interface{}{}
 	var err error
 
 	gws := pkg.ActiveSIGs.AttachedGateways(gwc)
@@ -124,6 +106,7 @@ func handleDeletingGatewayClass(ctx context.Context, req ctrl.Request) (ctrl.Res
 		return ctrl.Result{}, err
 	}
 
+	partition := pkg.ActiveSIGs.PartitionOfClass(req.Name)
 	pkg.ActiveSIGs.UnsetGatewayClass(req.Name)
 
 	if npcfgs, err = pkg.ParseServicesRelatedForAll(); err != nil {
@@ -135,26 +118,21 @@ func handleDeletingGatewayClass(ctx context.Context, req ctrl.Request) (ctrl.Res
 		Meta: fmt.Sprintf("clearing gateways for gatewayclass '%s'", req.Name),
 		From: &ocfgs,
 		To:   nil,
-		StatusFunc: func() {
+		StatusFunc: func(err error) {
+			r.feedback.report(ctx, gwc, err)
 		},
-		Partition: req.Name,
+		Partition: partition,
 		Context:   dctx,
 	}
 
-	pkg.PendingDeploys <- pkg.DeployRequest{
-		Meta: fmt.Sprintf("updating services for gatewayclass '%s'", req.Name),
-		From: &opcfgs,
-		To:   &npcfgs,
-		StatusFunc: func() {
-		},
-		Partition: "cis-c-tenant",
-		Context:   ctx,
-	}
+	deployServices(ctx, fmt.Sprintf("updating services for gatewayclass '%s'", req.Name), opcfgs, npcfgs, func(err error) {
+		r.feedback.report(ctx, gwc, err)
+	})
 
 	return ctrl.Result{}, nil
 }
 
-func handleUpsertingGatewayClass(ctx context.Context, obj *gatewayv1beta1.GatewayClass) (ctrl.Result, error) {
+func handleUpsertingGatewayClass(ctx context.Context, r *GatewayClassReconciler, obj *gatewayv1beta1.GatewayClass) (ctrl.Result, error) {
 	slog := utils.LogFromContext(ctx)
 
 	reqn := utils.Keyname(obj.Namespace, obj.Name)
@@ -166,49 +144,9 @@ func handleUpsertingGatewayClass(ctx context.Context, obj *gatewayv1beta1.Gatewa
 		return ctrl.Result{}, nil
 	}
 
-	ocfgs, ncfgs := map[string]interface{}{}, map[string]interface{}{}
-	opcfgs, npcfgs := map[string]interface{}{}, map[string]interface{}{}
-	var err error
-
-	if ogwc := pkg.ActiveSIGs.GetGatewayClass(reqn); ogwc != nil {
-		gws := pkg.ActiveSIGs.AttachedGateways(ogwc)
-		if ocfgs, err = pkg.ParseGatewayRelatedForClass(ogwc.Name, gws); err != nil {
-			return ctrl.Result{}, err
-		}
-	}
-	if opcfgs, err = pkg.ParseServicesRelatedForAll(); err != nil {
-		return ctrl.Result{}, err
-	}
-
-	pkg.ActiveSIGs.SetGatewayClass(ngwc)
-
-	if npcfgs, err = pkg.ParseServicesRelatedForAll(); err != nil {
-		return ctrl.Result{}, err
-	}
-
-	gws := pkg.ActiveSIGs.AttachedGateways(ngwc)
-	if ncfgs, err = pkg.ParseGatewayRelatedForClass(ngwc.Name, gws); err != nil {
-		return ctrl.Result{}, err
-	}
-
-	pkg.PendingDeploys <- pkg.DeployRequest{
-		Meta:       fmt.Sprintf("refreshing services for gatewayclass '%s'", reqn),
-		From:       &opcfgs,
-		To:         &npcfgs,
-		StatusFunc: func() {},
-		Partition:  "cis-c-tenant",
-		Context:    ctx,
-	}
-
-	cctx := context.WithValue(ctx, pkg.CtxKey_CreatePartition, "yes")
-	pkg.PendingDeploys <- pkg.DeployRequest{
-		Meta:       fmt.Sprintf("refreshing gateways for gatewayclass '%s'", reqn),
-		From:       &ocfgs,
-		To:         &ncfgs,
-		StatusFunc: func() {},
-		Partition:  reqn,
-		Context:    cctx,
-	}
-
-	return ctrl.Result{}, nil
+	err := redeployGatewayClasses(ctx, r.Client, []string{ngwc.Name}, fmt.Sprintf("gatewayclass '%s'", reqn),
+		func() { pkg.ActiveSIGs.SetGatewayClass(ngwc) },
+		func(err error) { r.feedback.report(ctx, ngwc, err) },
+	)
+	return ctrl.Result{}, err
 }
@@ -0,0 +1,128 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gitee.com/zongzw/bigip-kubernetes-gateway/pkg"
+	"gitee.com/zongzw/f5-bigip-rest/utils"
+	"github.com/google/uuid"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type GatewayClassParametersReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	feedback *deployFeedback
+}
+
+func (r *GatewayClassParametersReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	lctx := context.WithValue(ctx, utils.CtxKey_Logger, utils.NewLog(uuid.New().String(), "debug"))
+	slog := utils.LogFromContext(lctx)
+	if !pkg.ActiveSIGs.SyncedAtStart {
+		<-time.After(100 * time.Millisecond)
+		return ctrl.Result{Requeue: true}, nil
+	}
+	r.feedback.retry(lctx, req.NamespacedName.String())
+
+	obj := unstructured.Unstructured{}
+	obj.SetGroupVersionKind(pkg.ClassParametersGVK())
+
+	slog.Debugf("handling " + req.NamespacedName.String())
+	if err := r.Get(ctx, req.NamespacedName, &obj); err != nil {
+		if client.IgnoreNotFound(err) == nil {
+			// delete resources
+			defer pkg.ActiveSIGs.UnsetClassParameters(req.NamespacedName.String())
+			return handleDeletingClassParameters(lctx, r, req)
+		} else {
+			return ctrl.Result{}, err
+		}
+	} else {
+		// upsert resources
+		params, err := pkg.ClassParametersFromUnstructured(&obj)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		defer pkg.ActiveSIGs.SetClassParameters(params)
+		return handleUpsertingClassParameters(lctx, r, params, &obj)
+	}
+}
+
+// SetupWithManager sets up the controller with the Manager.
+// The controller is skipped if the CRD of BIGIPGatewayClassParameters is not installed,
+// in which case the gatewayclasses referring parameters are not accepted.
+func (r *GatewayClassParametersReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	gvk := pkg.ClassParametersGVK()
+	if _, err := mgr.GetRESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+		if meta.IsNoMatchError(err) {
+			ctrl.Log.Info(fmt.Sprintf("%s CRD is not installed, skip the controller", gvk.Kind))
+			return nil
+		}
+		return err
+	}
+
+	obj := unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+
+	r.feedback = newDeployFeedback(mgr.GetEventRecorderFor(eventRecorderName))
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&obj).
+		Watches(r.feedback.source()).
+		Complete(r)
+}
+
+func handleDeletingClassParameters(ctx context.Context, r *GatewayClassParametersReconciler, req ctrl.Request) (ctrl.Result, error) {
+	params := pkg.ActiveSIGs.GetClassParameters(req.NamespacedName.String())
+	if params == nil {
+		return ctrl.Result{}, nil
+	}
+
+	// the deleted object is rebuilt for the events and requeueing.
+	obj := unstructured.Unstructured{}
+	obj.SetGroupVersionKind(pkg.ClassParametersGVK())
+	obj.SetNamespace(params.Namespace)
+	obj.SetName(params.Name)
+	obj.SetUID(params.UID)
+
+	classNames := pkg.ActiveSIGs.GatewayClassesRefsOfParameters(req.NamespacedName.String())
+	err := redeployGatewayClasses(ctx, r.Client, classNames, fmt.Sprintf("deleting gatewayclass parameters '%s'", req.NamespacedName.String()),
+		func() { pkg.ActiveSIGs.UnsetClassParameters(req.NamespacedName.String()) },
+		func(err error) { r.feedback.report(ctx, &obj, err) },
+	)
+	return ctrl.Result{}, err
+}
+
+func handleUpsertingClassParameters(ctx context.Context, r *GatewayClassParametersReconciler,
+	params *pkg.BIGIPGatewayClassParameters, obj *unstructured.Unstructured) (ctrl.Result, error) {
+	slog := utils.LogFromContext(ctx)
+	reqnsn := utils.Keyname(params.Namespace, params.Name)
+	slog.Debugf("upserting " + reqnsn)
+
+	classNames := pkg.ActiveSIGs.GatewayClassesRefsOfParameters(reqnsn)
+	err := redeployGatewayClasses(ctx, r.Client, classNames, fmt.Sprintf("upserting gatewayclass parameters '%s'", reqnsn),
+		func() { pkg.ActiveSIGs.SetClassParameters(params) },
+		func(err error) { r.feedback.report(ctx, obj, err) },
+	)
+	return ctrl.Result{}, err
+}
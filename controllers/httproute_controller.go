@@ -33,7 +33,8 @@ import (
 
 type HttpRouteReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	feedback *deployFeedback
 }
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
@@ -52,6 +53,7 @@ func (r *HttpRouteReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		<-time.After(100 * time.Millisecond)
 		return ctrl.Result{Requeue: true}, nil
 	}
+	r.feedback.retry(lctx, req.NamespacedName.String())
 
 	var obj gatewayv1beta1.HTTPRoute
 
@@ -60,14 +62,14 @@ func (r *HttpRouteReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		if client.IgnoreNotFound(err) == nil {
 			// delete resources
 			defer pkg.ActiveSIGs.UnsetHTTPRoute(req.NamespacedName.String())
-			return handleDeletingHTTPRoute(lctx, req)
+			return handleDeletingHTTPRoute(lctx, r, req)
 		} else {
 			return ctrl.Result{}, err
 		}
 	} else {
 		// upsert resources
 		defer pkg.ActiveSIGs.SetHTTPRoute(&obj)
-		return handleUpsertingHTTPRoute(lctx, &obj)
+		return handleUpsertingHTTPRoute(lctx, r, &obj)
 	}
 }
 
@@ -78,20 +80,25 @@ func (r *HttpRouteReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	// if err := r.List(context.TODO(), &hrList, &client.ListOptions{}); err != nil {
 	// 	ctrl.Log.Error(err, "failed to list hrs")
 	// }
+	r.feedback = newDeployFeedback(mgr.GetEventRecorderFor(eventRecorderName))
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&gatewayv1beta1.HTTPRoute{}).
+		Watches(r.feedback.source()).
 		Complete(r)
 }
 
-func handleDeletingHTTPRoute(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func handleDeletingHTTPRoute(ctx context.Context, r *HttpRouteReconciler, req ctrl.Request) (ctrl.Result, error) {
 	hr := pkg.ActiveSIGs.GetHTTPRoute(req.NamespacedName.String())
+	if hr == nil {
+		return ctrl.Result{}, nil
+	}
 	gws := pkg.ActiveSIGs.GatewayRefsOf(hr)
 	drs := map[string]*pkg.DeployRequest{}
 	for _, gw := range gws {
 		if _, f := drs[string(gw.Spec.GatewayClassName)]; !f {
 			drs[string(gw.Spec.GatewayClassName)] = &pkg.DeployRequest{
 				Meta:      fmt.Sprintf("deleting httproute '%s'", req.NamespacedName.String()),
-				Partition: string(gw.Spec.GatewayClassName),
+				Partition: pkg.ActiveSIGs.PartitionOfClass(string(gw.Spec.GatewayClassName)),
 			}
 		}
 		dr := drs[string(gw.Spec.GatewayClassName)]
@@ -119,7 +126,7 @@ func handleDeletingHTTPRoute(ctx context.Context, req ctrl.Request) (ctrl.Result
 		if _, f := drs[string(gw.Spec.GatewayClassName)]; !f {
 			drs[string(gw.Spec.GatewayClassName)] = &pkg.DeployRequest{
 				Meta:      fmt.Sprintf("deleting httproute '%s'", req.NamespacedName.String()),
-				Partition: string(gw.Spec.GatewayClassName),
+				Partition: pkg.ActiveSIGs.PartitionOfClass(string(gw.Spec.GatewayClassName)),
 			}
 		}
 		dr := drs[string(gw.Spec.GatewayClassName)]
@@ -135,27 +142,23 @@ func handleDeletingHTTPRoute(ctx context.Context, req ctrl.Request) (ctrl.Result
 			Meta: dr.Meta,
 			From: dr.From,
 			To:   dr.To,
-			StatusFunc: func() {
+			StatusFunc: func(err error) {
+				updateStatusForGateways(ctx, r.Client, gatewayKeysOf(gws), err)
+				r.feedback.report(ctx, hr, err)
 			},
 			Partition: dr.Partition,
 			Context:   ctx,
 		}
 	}
 
-	pkg.PendingDeploys <- pkg.DeployRequest{
-		Meta: fmt.Sprintf("updating services for deleting httproute '%s'", req.NamespacedName.String()),
-		From: &opcfgs,
-		To:   &npcfgs,
-		StatusFunc: func() {
-		},
-		Partition: "cis-c-tenant",
-		Context:   ctx,
-	}
+	deployServices(ctx, fmt.Sprintf("updating services for deleting httproute '%s'", req.NamespacedName.String()), opcfgs, npcfgs, func(err error) {
+		r.feedback.report(ctx, hr, err)
+	})
 
 	return ctrl.Result{}, nil
 }
 
-func handleUpsertingHTTPRoute(ctx context.Context, obj *gatewayv1beta1.HTTPRoute) (ctrl.Result, error) {
+func handleUpsertingHTTPRoute(ctx context.Context, r *HttpRouteReconciler, obj *gatewayv1beta1.HTTPRoute) (ctrl.Result, error) {
 	slog := utils.LogFromContext(ctx)
 	reqnsn := utils.Keyname(obj.Namespace, obj.Name)
 	slog.Debugf("upserting " + reqnsn)
@@ -168,7 +171,7 @@ func handleUpsertingHTTPRoute(ctx context.Context, obj *gatewayv1beta1.HTTPRoute
 		if _, f := drs[string(gw.Spec.GatewayClassName)]; !f {
 			drs[string(gw.Spec.GatewayClassName)] = &pkg.DeployRequest{
 				Meta:      fmt.Sprintf("upserting httproute '%s'", reqnsn),
-				Partition: string(gw.Spec.GatewayClassName),
+				Partition: pkg.ActiveSIGs.PartitionOfClass(string(gw.Spec.GatewayClassName)),
 			}
 		}
 		dr := drs[string(gw.Spec.GatewayClassName)]
@@ -199,7 +202,7 @@ func handleUpsertingHTTPRoute(ctx context.Context, obj *gatewayv1beta1.HTTPRoute
 		if _, f := drs[string(gw.Spec.GatewayClassName)]; !f {
 			drs[string(gw.Spec.GatewayClassName)] = &pkg.DeployRequest{
 				Meta:      fmt.Sprintf("upserting httproute '%s'", reqnsn),
-				Partition: string(gw.Spec.GatewayClassName),
+				Partition: pkg.ActiveSIGs.PartitionOfClass(string(gw.Spec.GatewayClassName)),
 			}
 		}
 		dr := drs[string(gw.Spec.GatewayClassName)]
@@ -210,22 +213,20 @@ func handleUpsertingHTTPRoute(ctx context.Context, obj *gatewayv1beta1.HTTPRoute
 		}
 	}
 
-	pkg.PendingDeploys <- pkg.DeployRequest{
-		Meta: fmt.Sprintf("updating services for upserting httproute '%s'", reqnsn),
-		From: &opcfgs,
-		To:   &npcfgs,
-		StatusFunc: func() {
-		},
-		Partition: "cis-c-tenant",
-		Context:   ctx,
-	}
+	deployServices(ctx, fmt.Sprintf("updating services for upserting httproute '%s'", reqnsn), opcfgs, npcfgs, func(err error) {
+		// the httproute may not be attached to any gateway, its status is written here as well.
+		updateHTTPRouteStatus(ctx, r.Client, reqnsn)
+		r.feedback.report(ctx, obj, err)
+	})
 
 	for _, dr := range drs {
 		pkg.PendingDeploys <- pkg.DeployRequest{
 			Meta: dr.Meta,
 			From: dr.From,
 			To:   dr.To,
-			StatusFunc: func() {
+			StatusFunc: func(err error) {
+				updateStatusForGateways(ctx, r.Client, gatewayKeysOf(gws), err)
+				r.feedback.report(ctx, obj, err)
 			},
 			Partition: dr.Partition,
 			Context:   ctx,
@@ -0,0 +1,113 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gitee.com/zongzw/bigip-kubernetes-gateway/pkg"
+	"gitee.com/zongzw/f5-bigip-rest/utils"
+	"github.com/google/uuid"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+)
+
+type ReferenceGrantReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	feedback *deployFeedback
+}
+
+func (r *ReferenceGrantReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	lctx := context.WithValue(ctx, utils.CtxKey_Logger, utils.NewLog(uuid.New().String(), "debug"))
+	slog := utils.LogFromContext(lctx)
+	if !pkg.ActiveSIGs.SyncedAtStart {
+		<-time.After(100 * time.Millisecond)
+		return ctrl.Result{Requeue: true}, nil
+	}
+	r.feedback.retry(lctx, req.NamespacedName.String())
+
+	var obj gatewayv1alpha2.ReferenceGrant
+
+	slog.Debugf("handling " + req.NamespacedName.String())
+	if err := r.Get(ctx, req.NamespacedName, &obj); err != nil {
+		if client.IgnoreNotFound(err) == nil {
+			// delete resources
+			defer pkg.ActiveSIGs.UnsetReferenceGrant(req.NamespacedName.String())
+			return handleDeletingReferenceGrant(lctx, r, req)
+		} else {
+			return ctrl.Result{}, err
+		}
+	} else {
+		// upsert resources
+		defer pkg.ActiveSIGs.SetReferenceGrant(&obj)
+		return handleUpsertingReferenceGrant(lctx, r, &obj)
+	}
+}
+
+// SetupWithManager sets up the controller with the Manager.
+// ReferenceGrant is experimental, the controller is skipped if its CRD is not installed,
+// in which case the references across namespaces are never permitted.
+func (r *ReferenceGrantReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if installed, err := experimentalKindInstalled(mgr, "ReferenceGrant"); err != nil || !installed {
+		return err
+	}
+
+	r.feedback = newDeployFeedback(mgr.GetEventRecorderFor(eventRecorderName))
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&gatewayv1alpha2.ReferenceGrant{}).
+		Watches(r.feedback.source()).
+		Complete(r)
+}
+
+func handleDeletingReferenceGrant(ctx context.Context, r *ReferenceGrantReconciler, req ctrl.Request) (ctrl.Result, error) {
+	rg := pkg.ActiveSIGs.GetReferenceGrant(req.NamespacedName.String())
+	if rg == nil {
+		return ctrl.Result{}, nil
+	}
+
+	return redeployForReferenceGrant(ctx, r, rg, fmt.Sprintf("deleting referencegrant '%s'", req.NamespacedName.String()), func() {
+		pkg.ActiveSIGs.UnsetReferenceGrant(req.NamespacedName.String())
+	})
+}
+
+func handleUpsertingReferenceGrant(ctx context.Context, r *ReferenceGrantReconciler, obj *gatewayv1alpha2.ReferenceGrant) (ctrl.Result, error) {
+	slog := utils.LogFromContext(ctx)
+	reqnsn := utils.Keyname(obj.Namespace, obj.Name)
+	slog.Debugf("upserting " + reqnsn)
+
+	return redeployForReferenceGrant(ctx, r, obj, fmt.Sprintf("upserting referencegrant '%s'", reqnsn), func() {
+		pkg.ActiveSIGs.SetReferenceGrant(obj.DeepCopy())
+	})
+}
+
+// redeployForReferenceGrant parses the gateways referring to the namespace
+// of rg before and after change, and deploys the difference.
+func redeployForReferenceGrant(ctx context.Context, r *ReferenceGrantReconciler, rg *gatewayv1alpha2.ReferenceGrant,
+	meta string, change func()) (ctrl.Result, error) {
+
+	gws := pkg.ActiveSIGs.GatewaysReferringNamespace(rg.Namespace)
+	err := redeployGatewaysWithServices(ctx, r.Client, gws, meta, change, func(err error) {
+		r.feedback.report(ctx, rg, err)
+	})
+	return ctrl.Result{}, err
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"gitee.com/zongzw/bigip-kubernetes-gateway/pkg"
+	"gitee.com/zongzw/f5-bigip-rest/utils"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	eventRecorderName = "bigip-kubernetes-gateway"
+
+	requeueBaseDelay = 1 * time.Second
+	requeueMaxDelay  = 5 * time.Minute
+)
+
+// deployFeedback takes the deployment results back to the objects which
+// queued the DeployRequests: an event is recorded on the object, and the
+// object is requeued with backoff to redo the failed deployments.
+type deployFeedback struct {
+	mutex    sync.Mutex
+	recorder record.EventRecorder
+	events   chan event.GenericEvent
+	failures map[string]int
+	retries  map[string][]pkg.DeployRequest
+}
+
+func newDeployFeedback(recorder record.EventRecorder) *deployFeedback {
+	return &deployFeedback{
+		mutex:    sync.Mutex{},
+		recorder: recorder,
+		events:   make(chan event.GenericEvent),
+		failures: map[string]int{},
+		retries:  map[string][]pkg.DeployRequest{},
+	}
+}
+
+// source returns the watch source and its handler, with which the failed objects are requeued.
+func (f *deployFeedback) source() (source.Source, handler.EventHandler) {
+	return &source.Channel{Source: f.events}, &handler.EnqueueRequestForObject{}
+}
+
+// report handles the result of a DeployRequest queued for obj.
+func (f *deployFeedback) report(ctx context.Context, obj client.Object, err error) {
+	slog := utils.LogFromContext(ctx)
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	key := client.ObjectKeyFromObject(obj).String()
+	if err == nil {
+		if _, pending := f.retries[key]; pending {
+			// other deployments of the object are still waiting for retry.
+			return
+		}
+		if _, failed := f.failures[key]; failed {
+			delete(f.failures, key)
+			f.recorder.Event(obj, v1.EventTypeNormal, "Deployed", "Deployed to BIG-IP after retrying")
+		}
+		return
+	}
+
+	var derr *pkg.DeployError
+	if errors.As(err, &derr) {
+		f.retries[key] = append(f.retries[key], derr.Retries...)
+	}
+	f.failures[key]++
+	f.recorder.Event(obj, v1.EventTypeWarning, "DeployFailed", err.Error())
+
+	delay := requeueBaseDelay << (f.failures[key] - 1)
+	if delay > requeueMaxDelay || delay <= 0 {
+		delay = requeueMaxDelay
+	}
+	slog.Infof("requeue %s in %s for the failed deployment", key, delay.String())
+	time.AfterFunc(delay, func() {
+		f.events <- event.GenericEvent{Object: obj}
+	})
+}
+
+// retry sends the failed deployments of the object to PendingDeploys again,
+// the deployer deploys them with the latest configs parsed from the cache.
+func (f *deployFeedback) retry(ctx context.Context, key string) {
+	slog := utils.LogFromContext(ctx)
+
+	f.mutex.Lock()
+	retries := f.retries[key]
+	delete(f.retries, key)
+	f.mutex.Unlock()
+
+	for _, r := range retries {
+		slog.Debugf("retrying deployment: %s", r.Meta)
+		pkg.PendingDeploys <- r
+	}
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gitee.com/zongzw/bigip-kubernetes-gateway/pkg"
+	"gitee.com/zongzw/f5-bigip-rest/utils"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// NewDriftReporter returns the func recording an event for each drifted
+// resource repaired by the resync, on the object the resource is parsed from.
+func NewDriftReporter(mgr ctrl.Manager) func(pkg.DriftReport) {
+	recorder := mgr.GetEventRecorderFor(eventRecorderName)
+	return func(d pkg.DriftReport) {
+		reportDrift(recorder, d)
+	}
+}
+
+func reportDrift(recorder record.EventRecorder, d pkg.DriftReport) {
+	slog := utils.LogFromContext(context.TODO())
+
+	resource := fmt.Sprintf("%s /%s/%s", d.Kind, d.Partition, d.Name)
+	if d.Folder != "" {
+		resource = fmt.Sprintf("%s /%s/%s/%s", d.Kind, d.Partition, d.Folder, d.Name)
+	}
+	obj := driftOwnerOf(d)
+	if obj == nil {
+		if d.Err != nil {
+			slog.Errorf("unable to repair %s %s on %s: %s", resource, d.Reason, d.BIGIP, d.Err.Error())
+		} else {
+			slog.Infof("repaired %s %s on %s", resource, d.Reason, d.BIGIP)
+		}
+		return
+	}
+	if d.Err != nil {
+		recorder.Eventf(obj, v1.EventTypeWarning, "DriftRepairFailed", "unable to repair %s %s on %s: %s",
+			resource, d.Reason, d.BIGIP, d.Err.Error())
+	} else {
+		recorder.Eventf(obj, v1.EventTypeNormal, "DriftRepaired", "repaired %s %s on %s",
+			resource, d.Reason, d.BIGIP)
+	}
+}
+
+// driftOwnerOf returns the gatewayclass of the partition, or the service of
+// the pool in the backend partition, nil if none.
+func driftOwnerOf(d pkg.DriftReport) client.Object {
+	if gwc := pkg.ActiveSIGs.ClassOfPartition(d.Partition); gwc != nil {
+		return gwc
+	}
+	if d.Kind == "ltm/pool" {
+		// the pools of services are named as 'namespace.name'.
+		if nn := strings.SplitN(d.Name, ".", 2); len(nn) == 2 {
+			if svc := pkg.ActiveSIGs.GetService(utils.Keyname(nn[0], nn[1])); svc != nil {
+				return svc
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	"gitee.com/zongzw/bigip-kubernetes-gateway/pkg"
+	"gitee.com/zongzw/f5-bigip-rest/utils"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+)
+
+// updateGatewayClassStatus writes the 'Accepted' condition of the gatewayclass.
+func updateGatewayClassStatus(ctx context.Context, c client.Client, name string) {
+	slog := utils.LogFromContext(ctx)
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var obj gatewayv1beta1.GatewayClass
+		if err := c.Get(ctx, types.NamespacedName{Name: name}, &obj); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		ngwc := obj.DeepCopy()
+		pkg.SetGatewayClassStatus(ngwc)
+		if reflect.DeepEqual(obj.Status, ngwc.Status) {
+			return nil
+		}
+		return c.Status().Update(ctx, ngwc)
+	})
+	if err != nil {
+		slog.Errorf("unable to update status of gatewayclass %s: %s", name, err.Error())
+	}
+}
+
+// updateGatewayStatus writes the conditions and listeners' status of the gateway.
+// deployErr is the result of the latest deployment of the gateway.
+func updateGatewayStatus(ctx context.Context, c client.Client, keyname string, deployErr error) {
+	slog := utils.LogFromContext(ctx)
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var obj gatewayv1beta1.Gateway
+		if err := c.Get(ctx, namespacedNameOf(keyname), &obj); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		ngw := obj.DeepCopy()
+		pkg.ActiveSIGs.SetGatewayStatus(ngw, deployErr)
+		if reflect.DeepEqual(obj.Status, ngw.Status) {
+			return nil
+		}
+		return c.Status().Update(ctx, ngw)
+	})
+	if err != nil {
+		slog.Errorf("unable to update status of gateway %s: %s", keyname, err.Error())
+	}
+}
+
+// updateHTTPRouteStatus writes the parents' status of the httproute.
+func updateHTTPRouteStatus(ctx context.Context, c client.Client, keyname string) {
+	slog := utils.LogFromContext(ctx)
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var obj gatewayv1beta1.HTTPRoute
+		if err := c.Get(ctx, namespacedNameOf(keyname), &obj); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		nhr := obj.DeepCopy()
+		pkg.ActiveSIGs.SetHTTPRouteStatus(nhr)
+		if reflect.DeepEqual(obj.Status, nhr.Status) {
+			return nil
+		}
+		return c.Status().Update(ctx, nhr)
+	})
+	if err != nil {
+		slog.Errorf("unable to update status of httproute %s: %s", keyname, err.Error())
+	}
+}
+
+// updateTLSRouteStatus writes the parents' status of the tlsroute.
+func updateTLSRouteStatus(ctx context.Context, c client.Client, keyname string) {
+	slog := utils.LogFromContext(ctx)
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var obj gatewayv1alpha2.TLSRoute
+		if err := c.Get(ctx, namespacedNameOf(keyname), &obj); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		ntr := obj.DeepCopy()
+		pkg.ActiveSIGs.SetTLSRouteStatus(ntr)
+		if reflect.DeepEqual(obj.Status, ntr.Status) {
+			return nil
+		}
+		return c.Status().Update(ctx, ntr)
+	})
+	if err != nil {
+		slog.Errorf("unable to update status of tlsroute %s: %s", keyname, err.Error())
+	}
+}
+
+// updateGRPCRouteStatus writes the parents' status of the grpcroute.
+func updateGRPCRouteStatus(ctx context.Context, c client.Client, keyname string) {
+	slog := utils.LogFromContext(ctx)
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var obj gatewayv1alpha2.GRPCRoute
+		if err := c.Get(ctx, namespacedNameOf(keyname), &obj); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		ngr := obj.DeepCopy()
+		pkg.ActiveSIGs.SetGRPCRouteStatus(ngr)
+		if reflect.DeepEqual(obj.Status, ngr.Status) {
+			return nil
+		}
+		return c.Status().Update(ctx, ngr)
+	})
+	if err != nil {
+		slog.Errorf("unable to update status of grpcroute %s: %s", keyname, err.Error())
+	}
+}
+
+// updateTCPRouteStatus writes the parents' status of the tcproute.
+func updateTCPRouteStatus(ctx context.Context, c client.Client, keyname string) {
+	slog := utils.LogFromContext(ctx)
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var obj gatewayv1alpha2.TCPRoute
+		if err := c.Get(ctx, namespacedNameOf(keyname), &obj); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		ntcpr := obj.DeepCopy()
+		pkg.ActiveSIGs.SetTCPRouteStatus(ntcpr)
+		if reflect.DeepEqual(obj.Status, ntcpr.Status) {
+			return nil
+		}
+		return c.Status().Update(ctx, ntcpr)
+	})
+	if err != nil {
+		slog.Errorf("unable to update status of tcproute %s: %s", keyname, err.Error())
+	}
+}
+
+// updateUDPRouteStatus writes the parents' status of the udproute.
+func updateUDPRouteStatus(ctx context.Context, c client.Client, keyname string) {
+	slog := utils.LogFromContext(ctx)
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var obj gatewayv1alpha2.UDPRoute
+		if err := c.Get(ctx, namespacedNameOf(keyname), &obj); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		nudpr := obj.DeepCopy()
+		pkg.ActiveSIGs.SetUDPRouteStatus(nudpr)
+		if reflect.DeepEqual(obj.Status, nudpr.Status) {
+			return nil
+		}
+		return c.Status().Update(ctx, nudpr)
+	})
+	if err != nil {
+		slog.Errorf("unable to update status of udproute %s: %s", keyname, err.Error())
+	}
+}
+
+// updateStatusForGateways writes the status of the given gateways and
+// of all the routes refering them.
+// The gateways may have been deleted, the httproutes are still refreshed to drop the stale parents.
+func updateStatusForGateways(ctx context.Context, c client.Client, gwKeys []string, deployErr error) {
+	hrKeys, grKeys, trKeys, tcprKeys, udprKeys := []string{}, []string{}, []string{}, []string{}, []string{}
+	for _, gwKey := range utils.Unified(gwKeys) {
+		updateGatewayStatus(ctx, c, gwKey, deployErr)
+		for _, hr := range pkg.ActiveSIGs.HTTPRoutesRefsOfGateway(gwKey) {
+			hrKeys = append(hrKeys, utils.Keyname(hr.Namespace, hr.Name))
+		}
+		for _, gr := range pkg.ActiveSIGs.GRPCRoutesRefsOfGateway(gwKey) {
+			grKeys = append(grKeys, utils.Keyname(gr.Namespace, gr.Name))
+		}
+		for _, tr := range pkg.ActiveSIGs.TLSRoutesRefsOfGateway(gwKey) {
+			trKeys = append(trKeys, utils.Keyname(tr.Namespace, tr.Name))
+		}
+		for _, tcpr := range pkg.ActiveSIGs.TCPRoutesRefsOfGateway(gwKey) {
+			tcprKeys = append(tcprKeys, utils.Keyname(tcpr.Namespace, tcpr.Name))
+		}
+		for _, udpr := range pkg.ActiveSIGs.UDPRoutesRefsOfGateway(gwKey) {
+			udprKeys = append(udprKeys, utils.Keyname(udpr.Namespace, udpr.Name))
+		}
+	}
+	for _, hrKey := range utils.Unified(hrKeys) {
+		updateHTTPRouteStatus(ctx, c, hrKey)
+	}
+	for _, grKey := range utils.Unified(grKeys) {
+		updateGRPCRouteStatus(ctx, c, grKey)
+	}
+	for _, trKey := range utils.Unified(trKeys) {
+		updateTLSRouteStatus(ctx, c, trKey)
+	}
+	for _, tcprKey := range utils.Unified(tcprKeys) {
+		updateTCPRouteStatus(ctx, c, tcprKey)
+	}
+	for _, udprKey := range utils.Unified(udprKeys) {
+		updateUDPRouteStatus(ctx, c, udprKey)
+	}
+}
+
+func gatewayKeysOf(gws []*gatewayv1beta1.Gateway) []string {
+	keys := []string{}
+	for _, gw := range gws {
+		keys = append(keys, utils.Keyname(gw.Namespace, gw.Name))
+	}
+	return keys
+}
+
+func namespacedNameOf(keyname string) types.NamespacedName {
+	nsn := strings.Split(keyname, "/")
+	if len(nsn) == 1 {
+		return types.NamespacedName{Name: nsn[0]}
+	}
+	return types.NamespacedName{Namespace: nsn[0], Name: nsn[1]}
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"gitee.com/zongzw/bigip-kubernetes-gateway/pkg"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+)
+
+type TLSRouteReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	feedback *deployFeedback
+}
+
+var tlsRouteKind = &alpha2RouteKind{
+	kind:      "TLSRoute",
+	newObject: func() client.Object { return &gatewayv1alpha2.TLSRoute{} },
+	get: func(keyname string) client.Object {
+		if obj := pkg.ActiveSIGs.GetTLSRoute(keyname); obj != nil {
+			return obj
+		}
+		return nil
+	},
+	set:   func(obj client.Object) { pkg.ActiveSIGs.SetTLSRoute(obj.(*gatewayv1alpha2.TLSRoute)) },
+	unset: func(keyname string) { pkg.ActiveSIGs.UnsetTLSRoute(keyname) },
+	gatewayRefs: func(obj client.Object) []*gatewayv1beta1.Gateway {
+		return pkg.ActiveSIGs.GatewayRefsOfTLSRoute(obj.(*gatewayv1alpha2.TLSRoute))
+	},
+	updateStatus: updateTLSRouteStatus,
+}
+
+func (r *TLSRouteReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	return reconcileAlpha2Route(ctx, r.Client, r.feedback, tlsRouteKind, req)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *TLSRouteReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return setupAlpha2RouteWithManager(mgr, r, &r.feedback, tlsRouteKind)
+}
@@ -28,24 +28,44 @@ import (
 	"github.com/google/uuid"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
 )
 
 type EndpointsReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	feedback *deployFeedback
 }
 
 type ServiceReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	feedback *deployFeedback
 }
 
 type NodeReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme   *runtime.Scheme
+	feedback *deployFeedback
+}
+
+type SecretReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	feedback *deployFeedback
+}
+
+type ConfigMapReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	feedback *deployFeedback
 }
 
 type NamespaceReconciler struct {
@@ -80,19 +100,22 @@ func (r *NamespaceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 
 func (r *EndpointsReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	lctx := context.WithValue(ctx, utils.CtxKey_Logger, utils.NewLog(uuid.New().String(), "debug"))
+	r.feedback.retry(lctx, req.NamespacedName.String())
+
 	var obj v1.Endpoints
 	// // too many logs.
 	// slog.Debugf("endpoint event: " + req.NamespacedName.String())
 	if err := r.Get(ctx, req.NamespacedName, &obj); err != nil {
 		if client.IgnoreNotFound(err) == nil {
 			defer pkg.ActiveSIGs.UnsetEndpoints(req.NamespacedName.String())
-			return handleDeletingEndpoints(lctx, req)
+			defer pkg.ActiveSIGs.UnsetReadinessProbe(req.NamespacedName.String())
+			return handleDeletingEndpoints(lctx, r, req)
 		} else {
 			return ctrl.Result{}, err
 		}
 	} else {
 		defer pkg.ActiveSIGs.SetEndpoints(&obj)
-		return handleUpsertingEndpoints(lctx, &obj)
+		return handleUpsertingEndpoints(lctx, r, &obj)
 	}
 }
 
@@ -101,16 +124,65 @@ func (r *ServiceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 	lctx := context.WithValue(ctx, utils.CtxKey_Logger, utils.NewLog(uuid.New().String(), "debug"))
 	slog := utils.LogFromContext(lctx)
 	slog.Debugf("Service event: " + req.NamespacedName.String())
+	r.feedback.retry(lctx, req.NamespacedName.String())
 	if err := r.Get(ctx, req.NamespacedName, &obj); err != nil {
 		if client.IgnoreNotFound(err) == nil {
 			defer pkg.ActiveSIGs.UnsetService(req.NamespacedName.String())
-			return handleDeletingService(lctx, req)
+			return handleDeletingService(lctx, r, req)
 		} else {
 			return ctrl.Result{}, err
 		}
 	} else {
 		defer pkg.ActiveSIGs.SetService(&obj)
-		return handleUpsertingService(lctx, &obj)
+		return handleUpsertingService(lctx, r, &obj)
+	}
+}
+
+func (r *SecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	if !pkg.ActiveSIGs.SyncedAtStart {
+		<-time.After(100 * time.Millisecond)
+		return ctrl.Result{Requeue: true}, nil
+	}
+
+	var obj v1.Secret
+	lctx := context.WithValue(ctx, utils.CtxKey_Logger, utils.NewLog(uuid.New().String(), "debug"))
+	slog := utils.LogFromContext(lctx)
+	slog.Debugf("Secret event: " + req.NamespacedName.String())
+	r.feedback.retry(lctx, req.NamespacedName.String())
+	if err := r.Get(ctx, req.NamespacedName, &obj); err != nil {
+		if client.IgnoreNotFound(err) == nil {
+			defer pkg.ActiveSIGs.UnsetSecret(req.NamespacedName.String())
+			return handleDeletingSecret(lctx, r, req)
+		} else {
+			return ctrl.Result{}, err
+		}
+	} else {
+		defer pkg.ActiveSIGs.SetSecret(&obj)
+		return handleUpsertingSecret(lctx, r, &obj)
+	}
+}
+
+func (r *ConfigMapReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	if !pkg.ActiveSIGs.SyncedAtStart {
+		<-time.After(100 * time.Millisecond)
+		return ctrl.Result{Requeue: true}, nil
+	}
+
+	var obj v1.ConfigMap
+	lctx := context.WithValue(ctx, utils.CtxKey_Logger, utils.NewLog(uuid.New().String(), "debug"))
+	slog := utils.LogFromContext(lctx)
+	slog.Debugf("ConfigMap event: " + req.NamespacedName.String())
+	r.feedback.retry(lctx, req.NamespacedName.String())
+	if err := r.Get(ctx, req.NamespacedName, &obj); err != nil {
+		if client.IgnoreNotFound(err) == nil {
+			defer pkg.ActiveSIGs.UnsetConfigMap(req.NamespacedName.String())
+			return handleDeletingConfigMap(lctx, r, req)
+		} else {
+			return ctrl.Result{}, err
+		}
+	} else {
+		defer pkg.ActiveSIGs.SetConfigMap(&obj)
+		return handleUpsertingConfigMap(lctx, r, &obj)
 	}
 }
 
@@ -120,6 +192,7 @@ func (r *NodeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 		<-time.After(100 * time.Millisecond)
 		return ctrl.Result{Requeue: true}, nil
 	}
+	r.feedback.retry(lctx, req.NamespacedName.String())
 
 	ocfgs := map[string]interface{}{}
 	ncfgs := map[string]interface{}{}
@@ -127,6 +200,7 @@ func (r *NodeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 	var obj v1.Node
 	if err := r.Get(ctx, req.NamespacedName, &obj); err != nil {
 		if client.IgnoreNotFound(err) == nil {
+			obj.Name = req.Name
 			k8s.NodeCache.Unset(req.Name)
 			for _, c := range pkg.BIPConfigs {
 				if ncfgs, err = pkg.ParseNodeConfigs(&c); err != nil {
@@ -137,12 +211,14 @@ func (r *NodeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 				}
 				url := fmt.Sprintf("https://%s:%d", c.Management.IpAddress, *c.Management.Port)
 				pkg.PendingDeploys <- pkg.DeployRequest{
-					Meta:       fmt.Sprintf("refreshing for request '%s'", req.Name),
-					From:       &ocfgs,
-					To:         &ncfgs,
-					StatusFunc: func() {},
-					Partition:  "Common",
-					Context:    context.WithValue(lctx, pkg.CtxKey_SpecifiedBIGIP, url),
+					Meta: fmt.Sprintf("refreshing for request '%s'", req.Name),
+					From: &ocfgs,
+					To:   &ncfgs,
+					StatusFunc: func(err error) {
+						r.feedback.report(lctx, &obj, err)
+					},
+					Partition: "Common",
+					Context:   context.WithValue(lctx, pkg.CtxKey_SpecifiedBIGIP, url),
 				}
 			}
 
@@ -165,12 +241,14 @@ func (r *NodeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 			}
 			url := fmt.Sprintf("https://%s:%d", c.Management.IpAddress, *c.Management.Port)
 			pkg.PendingDeploys <- pkg.DeployRequest{
-				Meta:       fmt.Sprintf("refreshing for request '%s'", req.Name),
-				From:       &ocfgs,
-				To:         &ncfgs,
-				StatusFunc: func() {},
-				Partition:  "Common",
-				Context:    context.WithValue(lctx, pkg.CtxKey_SpecifiedBIGIP, url),
+				Meta: fmt.Sprintf("refreshing for request '%s'", req.Name),
+				From: &ocfgs,
+				To:   &ncfgs,
+				StatusFunc: func(err error) {
+					r.feedback.report(lctx, &obj, err)
+				},
+				Partition: "Common",
+				Context:   context.WithValue(lctx, pkg.CtxKey_SpecifiedBIGIP, url),
 			}
 		}
 	}
@@ -179,20 +257,35 @@ func (r *NodeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 
 // SetupReconcilerForCoreV1WithManager sets up the v1 controllers with the Manager.
 func SetupReconcilerForCoreV1WithManager(mgr ctrl.Manager) error {
-	rEps, rSvc, rNode, rNs :=
-		&EndpointsReconciler{Client: mgr.GetClient(), Scheme: mgr.GetScheme()},
-		&ServiceReconciler{Client: mgr.GetClient(), Scheme: mgr.GetScheme()},
-		&NodeReconciler{Client: mgr.GetClient(), Scheme: mgr.GetScheme()},
-		&NamespaceReconciler{Client: mgr.GetClient(), Scheme: mgr.GetScheme()}
-
-	err1, err2, err3, err4 :=
-		ctrl.NewControllerManagedBy(mgr).For(&v1.Endpoints{}).Complete(rEps),
-		ctrl.NewControllerManagedBy(mgr).For(&v1.Service{}).Complete(rSvc),
-		ctrl.NewControllerManagedBy(mgr).For(&v1.Node{}).Complete(rNode),
-		ctrl.NewControllerManagedBy(mgr).For(&v1.Namespace{}).Complete(rNs)
+	recorder := mgr.GetEventRecorderFor(eventRecorderName)
+	rEps, rSvc, rNode, rNs, rScrt, rCm :=
+		&EndpointsReconciler{Client: mgr.GetClient(), Scheme: mgr.GetScheme(), feedback: newDeployFeedback(recorder)},
+		&ServiceReconciler{Client: mgr.GetClient(), Scheme: mgr.GetScheme(), feedback: newDeployFeedback(recorder)},
+		&NodeReconciler{Client: mgr.GetClient(), Scheme: mgr.GetScheme(), feedback: newDeployFeedback(recorder)},
+		&NamespaceReconciler{Client: mgr.GetClient(), Scheme: mgr.GetScheme()},
+		&SecretReconciler{Client: mgr.GetClient(), Scheme: mgr.GetScheme(), feedback: newDeployFeedback(recorder)},
+		&ConfigMapReconciler{Client: mgr.GetClient(), Scheme: mgr.GetScheme(), feedback: newDeployFeedback(recorder)}
+
+	// the same secrets and configmaps are synced at start.
+	tlsOnly := builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		scrt, ok := obj.(*v1.Secret)
+		return ok && pkg.SecretReferable(scrt)
+	}))
+	caOnly := builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		cm, ok := obj.(*v1.ConfigMap)
+		return ok && pkg.ConfigMapReferable(cm)
+	}))
+
+	err1, err2, err3, err4, err5, err6 :=
+		ctrl.NewControllerManagedBy(mgr).For(&v1.Endpoints{}).Watches(rEps.feedback.source()).Complete(rEps),
+		ctrl.NewControllerManagedBy(mgr).For(&v1.Service{}).Watches(rSvc.feedback.source()).Complete(rSvc),
+		ctrl.NewControllerManagedBy(mgr).For(&v1.Node{}).Watches(rNode.feedback.source()).Complete(rNode),
+		ctrl.NewControllerManagedBy(mgr).For(&v1.Namespace{}).Complete(rNs),
+		ctrl.NewControllerManagedBy(mgr).For(&v1.Secret{}, tlsOnly).Watches(rScrt.feedback.source()).Complete(rScrt),
+		ctrl.NewControllerManagedBy(mgr).For(&v1.ConfigMap{}, caOnly).Watches(rCm.feedback.source()).Complete(rCm)
 
 	errmsg := ""
-	for _, err := range []error{err1, err2, err3, err4} {
+	for _, err := range []error{err1, err2, err3, err4, err5, err6} {
 		if err != nil {
 			errmsg += err.Error() + ";"
 		}
@@ -204,7 +297,7 @@ func SetupReconcilerForCoreV1WithManager(mgr ctrl.Manager) error {
 	}
 }
 
-func handleDeletingEndpoints(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+func handleDeletingEndpoints(ctx context.Context, r *EndpointsReconciler, req ctrl.Request) (ctrl.Result, error) {
 
 	svc := pkg.ActiveSIGs.GetService(req.NamespacedName.String())
 
@@ -222,31 +315,31 @@ func handleDeletingEndpoints(ctx context.Context, req ctrl.Request) (ctrl.Result
 		}
 
 		pkg.ActiveSIGs.UnsetEndpoints(req.NamespacedName.String())
+		pkg.ActiveSIGs.UnsetReadinessProbe(req.NamespacedName.String())
 		npcfgs, err := pkg.ParseReferedServiceKeys([]string{req.NamespacedName.String()})
 		if err != nil {
 			return ctrl.Result{}, err
 		}
 
-		pkg.PendingDeploys <- pkg.DeployRequest{
-			Meta: fmt.Sprintf("deleting endpoints '%s'", req.NamespacedName.String()),
-			From: &opcfgs,
-			To:   &npcfgs,
-			StatusFunc: func() {
-			},
-			Partition: "cis-c-tenant",
-			Context:   ctx,
-		}
+		deployServices(ctx, fmt.Sprintf("deleting endpoints '%s'", req.NamespacedName.String()), opcfgs, npcfgs, func(err error) {
+			eps := &v1.Endpoints{ObjectMeta: metav1.ObjectMeta{Namespace: req.Namespace, Name: req.Name}}
+			r.feedback.report(ctx, eps, err)
+		})
 
 	}
 
 	return ctrl.Result{}, nil
 }
 
-func handleUpsertingEndpoints(ctx context.Context, obj *v1.Endpoints) (ctrl.Result, error) {
+func handleUpsertingEndpoints(ctx context.Context, r *EndpointsReconciler, obj *v1.Endpoints) (ctrl.Result, error) {
 
 	reqnsn := utils.Keyname(obj.Namespace, obj.Name)
 	svc := pkg.ActiveSIGs.GetService(reqnsn)
 
+	// the monitor of the pool follows the readiness probe if not configured.
+	probe := readinessProbeOf(ctx, r.Client, obj)
+	defer pkg.ActiveSIGs.SetReadinessProbe(reqnsn, probe)
+
 	found := false
 	for _, gw := range pkg.ActiveSIGs.GetRootGateways([]*v1.Service{svc}) {
 		if pkg.ActiveSIGs.GetGatewayClass(string(gw.Spec.GatewayClassName)) != nil {
@@ -262,26 +355,43 @@ func handleUpsertingEndpoints(ctx context.Context, obj *v1.Endpoints) (ctrl.Resu
 		}
 
 		pkg.ActiveSIGs.SetEndpoints(obj.DeepCopy())
+		pkg.ActiveSIGs.SetReadinessProbe(reqnsn, probe)
 		npcfgs, err := pkg.ParseReferedServiceKeys([]string{reqnsn})
 		if err != nil {
 			return ctrl.Result{}, err
 		}
 
-		pkg.PendingDeploys <- pkg.DeployRequest{
-			Meta: fmt.Sprintf("upserting endpoints '%s'", reqnsn),
-			From: &opcfgs,
-			To:   &npcfgs,
-			StatusFunc: func() {
-			},
-			Partition: "cis-c-tenant",
-			Context:   ctx,
-		}
+		deployServices(ctx, fmt.Sprintf("upserting endpoints '%s'", reqnsn), opcfgs, npcfgs, func(err error) {
+			r.feedback.report(ctx, obj, err)
+		})
 	}
 
 	return ctrl.Result{}, nil
 }
 
-func handleDeletingService(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+// readinessProbeOf returns the readiness probe of the pods behind the endpoints,
+// the pods of a service are supposed to share the same probe.
+func readinessProbeOf(ctx context.Context, c client.Client, eps *v1.Endpoints) *v1.Probe {
+	slog := utils.LogFromContext(ctx)
+
+	for _, subset := range eps.Subsets {
+		for _, addr := range append(subset.Addresses, subset.NotReadyAddresses...) {
+			if addr.TargetRef == nil || addr.TargetRef.Kind != "Pod" {
+				continue
+			}
+			var pod v1.Pod
+			nsn := types.NamespacedName{Namespace: addr.TargetRef.Namespace, Name: addr.TargetRef.Name}
+			if err := c.Get(ctx, nsn, &pod); err != nil {
+				slog.Debugf("unable to get pod %s for readiness probe: %s", nsn.String(), err.Error())
+				continue
+			}
+			return k8s.ReadinessProbeOf(&pod)
+		}
+	}
+	return nil
+}
+
+func handleDeletingService(ctx context.Context, r *ServiceReconciler, req ctrl.Request) (ctrl.Result, error) {
 
 	svc := pkg.ActiveSIGs.GetService(req.NamespacedName.String())
 
@@ -292,7 +402,14 @@ func handleDeletingService(ctx context.Context, req ctrl.Request) (ctrl.Result,
 			break
 		}
 	}
-	if found {
+	if found && pkg.ListenersAffectedBy(svc, nil) {
+		// the listeners stop picking the server-ssl profile or persisting to the service.
+		err := redeployGatewaysWithServices(ctx, r.Client, pkg.ActiveSIGs.GetRootGateways([]*v1.Service{svc}),
+			fmt.Sprintf("deleting service '%s'", req.NamespacedName.String()),
+			func() { pkg.ActiveSIGs.UnsetService(req.NamespacedName.String()) },
+			func(err error) { reportForService(ctx, r, svc, err) })
+		return ctrl.Result{}, err
+	} else if found {
 		opcfgs, err := pkg.ParseReferedServiceKeys([]string{req.NamespacedName.String()})
 		if err != nil {
 			return ctrl.Result{}, err
@@ -304,15 +421,9 @@ func handleDeletingService(ctx context.Context, req ctrl.Request) (ctrl.Result,
 			return ctrl.Result{}, err
 		}
 
-		pkg.PendingDeploys <- pkg.DeployRequest{
-			Meta: fmt.Sprintf("deleting service '%s'", req.NamespacedName.String()),
-			From: &opcfgs,
-			To:   &npcfgs,
-			StatusFunc: func() {
-			},
-			Partition: "cis-c-tenant",
-			Context:   ctx,
-		}
+		deployServices(ctx, fmt.Sprintf("deleting service '%s'", req.NamespacedName.String()), opcfgs, npcfgs, func(err error) {
+			reportForService(ctx, r, svc, err)
+		})
 
 	}
 
@@ -320,11 +431,24 @@ func handleDeletingService(ctx context.Context, req ctrl.Request) (ctrl.Result,
 
 }
 
-func handleUpsertingService(ctx context.Context, obj *v1.Service) (ctrl.Result, error) {
+func handleUpsertingService(ctx context.Context, r *ServiceReconciler, obj *v1.Service) (ctrl.Result, error) {
 
 	reqnsn := utils.Keyname(obj.Namespace, obj.Name)
 	svc := pkg.ActiveSIGs.GetService(reqnsn)
 
+	// the pool falls back to the default monitor, the error is only reported.
+	if _, ok := obj.Annotations[pkg.AnnotationMonitorType]; ok {
+		if _, _, err := pkg.MonitorOfAnnotations(obj.Annotations); err != nil {
+			r.feedback.recorder.Event(obj, v1.EventTypeWarning, "InvalidMonitor", err.Error())
+		}
+	}
+	if err := pkg.CheckBackendTLS(obj); err != nil {
+		r.feedback.recorder.Event(obj, v1.EventTypeWarning, "InvalidBackendTLS", err.Error())
+	}
+	if err := pkg.CheckBackendOptions(obj); err != nil {
+		r.feedback.recorder.Event(obj, v1.EventTypeWarning, "InvalidBackendOptions", err.Error())
+	}
+
 	found := false
 	for _, gw := range pkg.ActiveSIGs.GetRootGateways([]*v1.Service{svc}) {
 		if pkg.ActiveSIGs.GetGatewayClass(string(gw.Spec.GatewayClassName)) != nil {
@@ -333,7 +457,14 @@ func handleUpsertingService(ctx context.Context, obj *v1.Service) (ctrl.Result,
 		}
 	}
 
-	if found {
+	if found && pkg.ListenersAffectedBy(svc, obj) {
+		// the listeners pick the server-ssl profiles and the persistence of the services they route to.
+		err := redeployGatewaysWithServices(ctx, r.Client, pkg.ActiveSIGs.GetRootGateways([]*v1.Service{svc}),
+			fmt.Sprintf("upserting service '%s'", reqnsn),
+			func() { pkg.ActiveSIGs.SetService(obj.DeepCopy()) },
+			func(err error) { reportForService(ctx, r, obj, err) })
+		return ctrl.Result{}, err
+	} else if found {
 		opcfgs, err := pkg.ParseReferedServiceKeys([]string{reqnsn})
 		if err != nil {
 			return ctrl.Result{}, err
@@ -345,16 +476,138 @@ func handleUpsertingService(ctx context.Context, obj *v1.Service) (ctrl.Result,
 			return ctrl.Result{}, err
 		}
 
+		deployServices(ctx, fmt.Sprintf("upserting service '%s'", reqnsn), opcfgs, npcfgs, func(err error) {
+			reportForService(ctx, r, obj, err)
+		})
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// reportForService refreshes the status of the routes referring svc with the
+// result of its deployment.
+func reportForService(ctx context.Context, r *ServiceReconciler, svc *v1.Service, err error) {
+	for _, hr := range pkg.ActiveSIGs.HTTPRoutesRefsOf(svc) {
+		updateHTTPRouteStatus(ctx, r.Client, utils.Keyname(hr.Namespace, hr.Name))
+	}
+	for _, gr := range pkg.ActiveSIGs.GRPCRoutesRefsOf(svc) {
+		updateGRPCRouteStatus(ctx, r.Client, utils.Keyname(gr.Namespace, gr.Name))
+	}
+	for _, tr := range pkg.ActiveSIGs.TLSRoutesRefsOf(svc) {
+		updateTLSRouteStatus(ctx, r.Client, utils.Keyname(tr.Namespace, tr.Name))
+	}
+	for _, tcpr := range pkg.ActiveSIGs.TCPRoutesRefsOf(svc) {
+		updateTCPRouteStatus(ctx, r.Client, utils.Keyname(tcpr.Namespace, tcpr.Name))
+	}
+	for _, udpr := range pkg.ActiveSIGs.UDPRoutesRefsOf(svc) {
+		updateUDPRouteStatus(ctx, r.Client, utils.Keyname(udpr.Namespace, udpr.Name))
+	}
+	r.feedback.report(ctx, svc, err)
+}
+
+func handleDeletingSecret(ctx context.Context, r *SecretReconciler, req ctrl.Request) (ctrl.Result, error) {
+	slog := utils.LogFromContext(ctx)
+
+	gws := pkg.ActiveSIGs.GatewayRefsOfSecret(req.NamespacedName.String())
+	if len(gws) == 0 {
+		return ctrl.Result{}, nil
+	}
+
+	// the certificates are kept on BIG-IP until the listeners refer to other secrets.
+	slog.Infof("secret %s is deleted but still referred by %d gateways", req.NamespacedName.String(), len(gws))
+	pkg.ActiveSIGs.UnsetSecret(req.NamespacedName.String())
+	updateStatusForGateways(ctx, r.Client, gatewayKeysOf(gws), nil)
+
+	return ctrl.Result{}, nil
+}
+
+func handleUpsertingSecret(ctx context.Context, r *SecretReconciler, obj *v1.Secret) (ctrl.Result, error) {
+	slog := utils.LogFromContext(ctx)
+	reqnsn := utils.Keyname(obj.Namespace, obj.Name)
+
+	// the CA and client certificates of backend TLS are in the pools' partition.
+	svcKeys := pkg.ActiveSIGs.ServiceKeysRefsOfBackendTLS("Secret", reqnsn)
+	if len(svcKeys) > 0 {
+		err := redeployServiceKeys(ctx, svcKeys, fmt.Sprintf("upserting secret '%s' for services", reqnsn),
+			func() { pkg.ActiveSIGs.SetSecret(obj.DeepCopy()) },
+			func(err error) { r.feedback.report(ctx, obj, err) })
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	gws := pkg.ActiveSIGs.GatewayRefsOfSecret(reqnsn)
+	classes := map[string][]*gatewayv1beta1.Gateway{}
+	for _, gw := range gws {
+		className := string(gw.Spec.GatewayClassName)
+		classes[className] = append(classes[className], gw)
+	}
+
+	drs := map[string]*pkg.DeployRequest{}
+	for className, cgws := range classes {
+		drs[className] = &pkg.DeployRequest{
+			Meta:      fmt.Sprintf("upserting secret '%s'", reqnsn),
+			Partition: pkg.ActiveSIGs.PartitionOfClass(className),
+		}
+		if ocfgs, err := pkg.ParseGatewayRelatedForClass(className, cgws); err != nil {
+			// the secret may be missing before, in which case nothing was deployed for these gateways.
+			slog.Debugf("no previous configs for class %s: %s", className, err.Error())
+			drs[className].From = &map[string]interface{}{}
+		} else {
+			drs[className].From = &ocfgs
+		}
+	}
+
+	pkg.ActiveSIGs.SetSecret(obj.DeepCopy())
+
+	for className, cgws := range classes {
+		if ncfgs, err := pkg.ParseGatewayRelatedForClass(className, cgws); err != nil {
+			updateStatusForGateways(ctx, r.Client, gatewayKeysOf(cgws), err)
+			return ctrl.Result{}, err
+		} else {
+			drs[className].To = &ncfgs
+		}
+	}
+
+	for className, dr := range drs {
+		cgws := classes[className]
 		pkg.PendingDeploys <- pkg.DeployRequest{
-			Meta: fmt.Sprintf("upserting service '%s'", reqnsn),
-			From: &opcfgs,
-			To:   &npcfgs,
-			StatusFunc: func() {
+			Meta: dr.Meta,
+			From: dr.From,
+			To:   dr.To,
+			StatusFunc: func(err error) {
+				updateStatusForGateways(ctx, r.Client, gatewayKeysOf(cgws), err)
+				r.feedback.report(ctx, obj, err)
 			},
-			Partition: "cis-c-tenant",
+			Partition: dr.Partition,
 			Context:   ctx,
 		}
 	}
 
 	return ctrl.Result{}, nil
 }
+
+func handleDeletingConfigMap(ctx context.Context, r *ConfigMapReconciler, req ctrl.Request) (ctrl.Result, error) {
+	slog := utils.LogFromContext(ctx)
+
+	// the same as secrets, the CA certificates are kept on BIG-IP until the services refer to others.
+	if svcKeys := pkg.ActiveSIGs.ServiceKeysRefsOfBackendTLS("ConfigMap", req.NamespacedName.String()); len(svcKeys) > 0 {
+		slog.Infof("configmap %s is deleted but still referred by %d services", req.NamespacedName.String(), len(svcKeys))
+	}
+	pkg.ActiveSIGs.UnsetConfigMap(req.NamespacedName.String())
+
+	return ctrl.Result{}, nil
+}
+
+func handleUpsertingConfigMap(ctx context.Context, r *ConfigMapReconciler, obj *v1.ConfigMap) (ctrl.Result, error) {
+	reqnsn := utils.Keyname(obj.Namespace, obj.Name)
+
+	svcKeys := pkg.ActiveSIGs.ServiceKeysRefsOfBackendTLS("ConfigMap", reqnsn)
+	if len(svcKeys) == 0 {
+		return ctrl.Result{}, nil
+	}
+	err := redeployServiceKeys(ctx, svcKeys, fmt.Sprintf("upserting configmap '%s'", reqnsn),
+		func() { pkg.ActiveSIGs.SetConfigMap(obj.DeepCopy()) },
+		func(err error) { r.feedback.report(ctx, obj, err) })
+	return ctrl.Result{}, err
+}
@@ -5,6 +5,7 @@ import (
 
 	"gitee.com/zongzw/f5-bigip-rest/utils"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 func FormatMembersFromServiceEndpoints(svc *v1.Service, eps *v1.Endpoints) ([]SvcEpsMember, error) {
@@ -69,3 +70,32 @@ func FormatMembersFromServiceEndpoints(svc *v1.Service, eps *v1.Endpoints) ([]Sv
 
 	return members, nil
 }
+
+// ReadinessProbeOf returns the first readiness probe of the containers of pod,
+// with its named port resolved to the container port.
+func ReadinessProbeOf(pod *v1.Pod) *v1.Probe {
+	for _, c := range pod.Spec.Containers {
+		if c.ReadinessProbe == nil {
+			continue
+		}
+		probe := c.ReadinessProbe.DeepCopy()
+		resolve := func(port *intstr.IntOrString) {
+			if port.Type != intstr.String {
+				return
+			}
+			for _, cp := range c.Ports {
+				if cp.Name == port.StrVal {
+					*port = intstr.FromInt(int(cp.ContainerPort))
+				}
+			}
+		}
+		if probe.HTTPGet != nil {
+			resolve(&probe.HTTPGet.Port)
+		}
+		if probe.TCPSocket != nil {
+			resolve(&probe.TCPSocket.Port)
+		}
+		return probe
+	}
+	return nil
+}
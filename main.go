@@ -49,6 +49,7 @@ import (
 
 	//+kubebuilder:scaffold:imports
 
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
 	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
 )
 
@@ -60,6 +61,7 @@ var (
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	utilruntime.Must(gatewayv1beta1.AddToScheme(scheme))
+	utilruntime.Must(gatewayv1alpha2.AddToScheme(scheme))
 }
 
 // 530  kubebuilder init --domain f5.com --repo f5.com/bigip-k8s-gateway
@@ -73,6 +75,10 @@ func main() {
 		credsDir             string
 		confDir              string
 		controllerName       string
+		backendPartition     string
+		deployDebounce       time.Duration
+		resyncInterval       time.Duration
+		deleteOrphans        bool
 	)
 
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
@@ -85,6 +91,14 @@ func main() {
 		"password file. To be used instead of bigip-password arguments.")
 	flag.StringVar(&confDir, "bigip-config-directory", "/bigip-config", "Directory of bigip-k8s-gw-conf.yaml file.")
 	flag.StringVar(&controllerName, "controller-name", "f5.io/gateway-controller-name", "This controller name.")
+	flag.StringVar(&backendPartition, "backend-partition", "cis-c-tenant", "The BIG-IP partition of the pools, "+
+		"which can be overridden per gatewayclass by the backendPartition of its parameters.")
+	flag.DurationVar(&deployDebounce, "deploy-debounce", 200*time.Millisecond, "How long a deployment waits "+
+		"for the following ones of the same partition to be merged into it, 0 to disable.")
+	flag.DurationVar(&resyncInterval, "resync-interval", 5*time.Minute, "How often the resources on the BIG-IPs "+
+		"are checked and repaired if modified or deleted by hand, 0 to disable.")
+	flag.BoolVar(&deleteOrphans, "reconcile-delete-orphans", false, "Delete the orphaned resources "+
+		"and the unused partitions created by the controller found at startup, they are only logged if false.")
 
 	opts := zap.Options{
 		Development: true,
@@ -93,6 +107,10 @@ func main() {
 	flag.Parse()
 
 	pkg.ActiveSIGs.ControllerName = controllerName
+	pkg.ActiveSIGs.BackendPartition = backendPartition
+	pkg.DeployDebounce = deployDebounce
+	pkg.ResyncInterval = resyncInterval
+	pkg.ReconcileDeleteOrphans = deleteOrphans
 	if err := setupBIGIPs(credsDir, confDir); err != nil {
 		setupLog.Error(err, "failed to setup BIG-IPs")
 		os.Exit(1)
@@ -126,6 +144,8 @@ func main() {
 	prometheus.MustRegister(utils.FunctionDurationTimeCostTotal)
 	prometheus.MustRegister(f5_bigip.BIGIPiControlTimeCostCount)
 	prometheus.MustRegister(f5_bigip.BIGIPiControlTimeCostTotal)
+	prometheus.MustRegister(pkg.OutOfSyncPartitions)
+	prometheus.MustRegister(pkg.DriftedResources)
 	mgr.AddMetricsExtraHandler("/stats", promhttp.Handler())
 
 	setupReconcilers(mgr)
@@ -140,8 +160,14 @@ func main() {
 
 	stopCh := make(chan struct{})
 	go pkg.Deployer(stopCh, pkg.BIGIPs)
-	go pkg.ActiveSIGs.SyncAllResources(mgr)
+	go func() {
+		// the orphans are not known without all the resources synced.
+		if err := pkg.ActiveSIGs.SyncAllResources(mgr); err == nil {
+			pkg.ReconcileAtStart(pkg.BIGIPs)
+		}
+	}()
 	go applyNodeConfigsAtStart()
+	go pkg.Resyncer(stopCh, pkg.BIGIPs, controllers.NewDriftReporter(mgr))
 
 	setupLog.Info("starting manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
@@ -204,7 +230,7 @@ func applyNodeConfigsAtStart() {
 				Meta:       "net setup at startup",
 				From:       nil,
 				To:         &ncfgs,
-				StatusFunc: func() {},
+				StatusFunc: func(err error) {},
 				Partition:  "Common",
 				Context:    context.WithValue(lctx, pkg.CtxKey_SpecifiedBIGIP, url),
 			}
@@ -221,6 +247,13 @@ func setupReconcilers(mgr manager.Manager) {
 		os.Exit(1)
 	}
 
+	if err := (&controllers.GatewayClassParametersReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "GatewayClassParameters")
+		os.Exit(1)
+	}
 	if err := (&controllers.GatewayReconciler{
 		Client: mgr.GetClient(),
 		Scheme: mgr.GetScheme(),
@@ -235,6 +268,41 @@ func setupReconcilers(mgr manager.Manager) {
 		setupLog.Error(err, "unable to create controller", "controller", "HttpRoute")
 		os.Exit(1)
 	}
+	if err := (&controllers.TLSRouteReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "TLSRoute")
+		os.Exit(1)
+	}
+	if err := (&controllers.GRPCRouteReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "GRPCRoute")
+		os.Exit(1)
+	}
+	if err := (&controllers.TCPRouteReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "TCPRoute")
+		os.Exit(1)
+	}
+	if err := (&controllers.UDPRouteReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "UDPRoute")
+		os.Exit(1)
+	}
+	if err := (&controllers.ReferenceGrantReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ReferenceGrant")
+		os.Exit(1)
+	}
 
 	if err := controllers.SetupReconcilerForCoreV1WithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Endpoints")
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"reflect"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,9 +17,12 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
 	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
 
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 func init() {
@@ -28,10 +33,22 @@ func init() {
 		ControllerName: "",
 		Gateway:        map[string]*gatewayv1beta1.Gateway{},
 		HTTPRoute:      map[string]*gatewayv1beta1.HTTPRoute{},
+		TLSRoute:       map[string]*gatewayv1alpha2.TLSRoute{},
+		GRPCRoute:      map[string]*gatewayv1alpha2.GRPCRoute{},
+		TCPRoute:       map[string]*gatewayv1alpha2.TCPRoute{},
+		UDPRoute:       map[string]*gatewayv1alpha2.UDPRoute{},
 		Endpoints:      map[string]*v1.Endpoints{},
 		Service:        map[string]*v1.Service{},
+		Secret:         map[string]*v1.Secret{},
+		ConfigMap:      map[string]*v1.ConfigMap{},
 		GatewayClass:   map[string]*gatewayv1beta1.GatewayClass{},
 		Namespace:      map[string]*v1.Namespace{},
+		ReferenceGrant: map[string]*gatewayv1alpha2.ReferenceGrant{},
+		ReadinessProbe: map[string]*v1.Probe{},
+
+		ClassParameters: map[string]*BIGIPGatewayClassParameters{},
+
+		BackendPartition: "cis-c-tenant",
 	}
 }
 
@@ -81,6 +98,210 @@ func (c *SIGCache) GetGatewayClass(keyname string) *gatewayv1beta1.GatewayClass
 	return c.GatewayClass[keyname]
 }
 
+func (c *SIGCache) SetClassParameters(obj *BIGIPGatewayClassParameters) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if obj != nil {
+		c.ClassParameters[utils.Keyname(obj.Namespace, obj.Name)] = obj
+	}
+}
+
+func (c *SIGCache) UnsetClassParameters(keyname string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.ClassParameters, keyname)
+}
+
+func (c *SIGCache) GetClassParameters(keyname string) *BIGIPGatewayClassParameters {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.ClassParameters[keyname]
+}
+
+// ClassParametersOf returns the spec of the parameters referred by the gatewayclass,
+// nil if it refers nothing, or an error if the reference or the parameters are invalid.
+func (c *SIGCache) ClassParametersOf(gwc *gatewayv1beta1.GatewayClass) (*BIGIPGatewayClassParametersSpec, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c._classParametersOf(gwc)
+}
+
+func (c *SIGCache) _classParametersOf(gwc *gatewayv1beta1.GatewayClass) (*BIGIPGatewayClassParametersSpec, error) {
+	if gwc == nil || gwc.Spec.ParametersRef == nil {
+		return nil, nil
+	}
+	ref := gwc.Spec.ParametersRef
+	if string(ref.Group) != ClassParametersGroup || string(ref.Kind) != ClassParametersKind {
+		return nil, fmt.Errorf("unsupported parametersRef %s/%s, only %s/%s is supported",
+			ref.Group, ref.Kind, ClassParametersGroup, ClassParametersKind)
+	}
+	if ref.Namespace == nil || *ref.Namespace == "" {
+		return nil, fmt.Errorf("namespace of parametersRef %s is required", ref.Name)
+	}
+	keyname := utils.Keyname(string(*ref.Namespace), ref.Name)
+	params, ok := c.ClassParameters[keyname]
+	if !ok {
+		return nil, fmt.Errorf("parameters %s not found", keyname)
+	}
+
+	spec := params.Spec
+	if strings.Contains(spec.Partition, "/") || strings.Contains(spec.BackendPartition, "/") {
+		return nil, fmt.Errorf("invalid partition of parameters %s", keyname)
+	}
+	if spec.Partition == "Common" || spec.BackendPartition == "Common" {
+		return nil, fmt.Errorf("partition Common of parameters %s is reserved", keyname)
+	}
+	partition, backendPartition := spec.Partition, spec.BackendPartition
+	if partition == "" {
+		partition = gwc.Name
+	}
+	if backendPartition == "" {
+		backendPartition = c.BackendPartition
+	}
+	if partition == backendPartition {
+		return nil, fmt.Errorf("partition and backendPartition of parameters %s must differ", keyname)
+	}
+	if partition == c.BackendPartition {
+		return nil, fmt.Errorf("partition %s of parameters %s is the default backend partition", partition, keyname)
+	}
+	// only the newer one of the classes in conflict is invalid, the deployed older one is kept.
+	for _, o := range c.GatewayClass {
+		if o.Name == gwc.Name || o.Spec.ControllerName != gatewayv1beta1.GatewayController(c.ControllerName) ||
+			!classCreatedBefore(o, gwc) {
+			continue
+		}
+		if p := c._partitionOfClass(o.Name); p == partition || p == backendPartition {
+			return nil, fmt.Errorf("partition %s of gatewayclass %s is used by parameters %s", p, o.Name, keyname)
+		}
+		if c._backendPartitionOfClass(o.Name) == partition {
+			return nil, fmt.Errorf("partition %s of parameters %s is the backend partition of gatewayclass %s", partition, keyname, o.Name)
+		}
+	}
+	if spec.RouteDomain != nil && (*spec.RouteDomain < 0 || *spec.RouteDomain > 65534) {
+		return nil, fmt.Errorf("invalid routeDomain %d of parameters %s", *spec.RouteDomain, keyname)
+	}
+	if spec.SNAT != nil {
+		switch spec.SNAT.Mode {
+		case "automap", "none":
+		case "snatpool":
+			if len(spec.SNAT.Addresses) == 0 {
+				return nil, fmt.Errorf("snat addresses of parameters %s are required by snatpool", keyname)
+			}
+		default:
+			return nil, fmt.Errorf("invalid snat mode %s of parameters %s, must be automap, snatpool or none", spec.SNAT.Mode, keyname)
+		}
+	}
+	return &spec, nil
+}
+
+// PartitionOfClass returns the BIG-IP partition of the gateways of the class,
+// which is the partition of its parameters if set, or the class name.
+func (c *SIGCache) PartitionOfClass(className string) string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c._partitionOfClass(className)
+}
+
+func (c *SIGCache) _partitionOfClass(className string) string {
+	if params := c._rawClassParametersOf(className); params != nil && params.Spec.Partition != "" {
+		return params.Spec.Partition
+	}
+	return className
+}
+
+// ClassOfPartition returns the gatewayclass of this controller deployed to the partition, or nil.
+func (c *SIGCache) ClassOfPartition(partition string) *gatewayv1beta1.GatewayClass {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	for _, gwc := range c.GatewayClass {
+		if gwc.Spec.ControllerName == gatewayv1beta1.GatewayController(c.ControllerName) &&
+			c._partitionOfClass(gwc.Name) == partition {
+			return gwc
+		}
+	}
+	return nil
+}
+
+// ClassPartitions returns the partitions of the gatewayclasses of this controller.
+func (c *SIGCache) ClassPartitions() []string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	partitions := []string{}
+	for _, gwc := range c.GatewayClass {
+		if gwc.Spec.ControllerName == gatewayv1beta1.GatewayController(c.ControllerName) {
+			partitions = append(partitions, c._partitionOfClass(gwc.Name))
+		}
+	}
+	return partitions
+}
+
+// BackendPartitions returns the default backend partition and the ones of
+// the gatewayclasses of this controller.
+func (c *SIGCache) BackendPartitions() []string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	partitions := []string{c.BackendPartition}
+	for _, gwc := range c.GatewayClass {
+		if gwc.Spec.ControllerName == gatewayv1beta1.GatewayController(c.ControllerName) {
+			partitions = append(partitions, c._backendPartitionOfClass(gwc.Name))
+		}
+	}
+	return partitions
+}
+
+// BackendPartitionOfClass returns the BIG-IP partition of the pools of the class,
+// which is the backendPartition of its parameters if set, or the default one.
+func (c *SIGCache) BackendPartitionOfClass(className string) string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c._backendPartitionOfClass(className)
+}
+
+func (c *SIGCache) _backendPartitionOfClass(className string) string {
+	if params := c._rawClassParametersOf(className); params != nil && params.Spec.BackendPartition != "" {
+		return params.Spec.BackendPartition
+	}
+	return c.BackendPartition
+}
+
+// _rawClassParametersOf returns the parameters referred by the class without validation.
+func (c *SIGCache) _rawClassParametersOf(className string) *BIGIPGatewayClassParameters {
+	gwc, ok := c.GatewayClass[className]
+	if !ok || gwc.Spec.ParametersRef == nil || gwc.Spec.ParametersRef.Namespace == nil {
+		return nil
+	}
+	ref := gwc.Spec.ParametersRef
+	return c.ClassParameters[utils.Keyname(string(*ref.Namespace), ref.Name)]
+}
+
+// GatewayClassesRefsOfParameters returns the names of the gatewayclasses referring the parameters.
+func (c *SIGCache) GatewayClassesRefsOfParameters(keyname string) []string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	names := []string{}
+	for _, gwc := range c.GatewayClass {
+		ref := gwc.Spec.ParametersRef
+		if ref == nil || ref.Namespace == nil ||
+			string(ref.Group) != ClassParametersGroup || string(ref.Kind) != ClassParametersKind {
+			continue
+		}
+		if utils.Keyname(string(*ref.Namespace), ref.Name) == keyname {
+			names = append(names, gwc.Name)
+		}
+	}
+	return names
+}
+
 func (c *SIGCache) SetGateway(obj *gatewayv1beta1.Gateway) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
@@ -127,6 +348,75 @@ func (c *SIGCache) GetHTTPRoute(keyname string) *gatewayv1beta1.HTTPRoute {
 	return c.HTTPRoute[keyname]
 }
 
+func (c *SIGCache) SetTLSRoute(obj *gatewayv1alpha2.TLSRoute) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if obj != nil {
+		c.TLSRoute[utils.Keyname(obj.Namespace, obj.Name)] = obj
+	}
+}
+
+func (c *SIGCache) UnsetTLSRoute(keyname string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.TLSRoute, keyname)
+}
+
+func (c *SIGCache) GetTLSRoute(keyname string) *gatewayv1alpha2.TLSRoute {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.TLSRoute[keyname]
+}
+
+func (c *SIGCache) SetTCPRoute(obj *gatewayv1alpha2.TCPRoute) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if obj != nil {
+		c.TCPRoute[utils.Keyname(obj.Namespace, obj.Name)] = obj
+	}
+}
+
+func (c *SIGCache) UnsetTCPRoute(keyname string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.TCPRoute, keyname)
+}
+
+func (c *SIGCache) GetTCPRoute(keyname string) *gatewayv1alpha2.TCPRoute {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.TCPRoute[keyname]
+}
+
+func (c *SIGCache) SetUDPRoute(obj *gatewayv1alpha2.UDPRoute) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if obj != nil {
+		c.UDPRoute[utils.Keyname(obj.Namespace, obj.Name)] = obj
+	}
+}
+
+func (c *SIGCache) UnsetUDPRoute(keyname string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.UDPRoute, keyname)
+}
+
+func (c *SIGCache) GetUDPRoute(keyname string) *gatewayv1alpha2.UDPRoute {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.UDPRoute[keyname]
+}
+
 func (c *SIGCache) GetService(keyname string) *v1.Service {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
@@ -141,138 +431,563 @@ func (c *SIGCache) GetEndpoints(keyname string) *v1.Endpoints {
 	return c.Endpoints[keyname]
 }
 
-func (c *SIGCache) SetEndpoints(eps *v1.Endpoints) {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
+func (c *SIGCache) SetEndpoints(eps *v1.Endpoints) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if eps != nil {
+		c.Endpoints[utils.Keyname(eps.Namespace, eps.Name)] = eps
+	}
+}
+func (c *SIGCache) UnsetEndpoints(keyname string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.Endpoints, keyname)
+}
+
+func (c *SIGCache) GetReadinessProbe(keyname string) *v1.Probe {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.ReadinessProbe[keyname]
+}
+
+func (c *SIGCache) SetReadinessProbe(keyname string, probe *v1.Probe) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if probe != nil {
+		c.ReadinessProbe[keyname] = probe
+	} else {
+		delete(c.ReadinessProbe, keyname)
+	}
+}
+
+func (c *SIGCache) UnsetReadinessProbe(keyname string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.ReadinessProbe, keyname)
+}
+
+func (c *SIGCache) SetService(svc *v1.Service) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if svc != nil {
+		c.Service[utils.Keyname(svc.Namespace, svc.Name)] = svc
+	}
+}
+func (c *SIGCache) UnsetService(keyname string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.Service, keyname)
+}
+
+func (c *SIGCache) GetSecret(keyname string) *v1.Secret {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.Secret[keyname]
+}
+
+func (c *SIGCache) SetSecret(scrt *v1.Secret) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if scrt != nil {
+		c.Secret[utils.Keyname(scrt.Namespace, scrt.Name)] = scrt
+	}
+}
+
+func (c *SIGCache) UnsetSecret(keyname string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.Secret, keyname)
+}
+
+func (c *SIGCache) GetConfigMap(keyname string) *v1.ConfigMap {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.ConfigMap[keyname]
+}
+
+func (c *SIGCache) SetConfigMap(obj *v1.ConfigMap) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if obj != nil {
+		c.ConfigMap[utils.Keyname(obj.Namespace, obj.Name)] = obj
+	}
+}
+
+func (c *SIGCache) UnsetConfigMap(keyname string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.ConfigMap, keyname)
+}
+
+func (c *SIGCache) GetReferenceGrant(keyname string) *gatewayv1alpha2.ReferenceGrant {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.ReferenceGrant[keyname]
+}
+
+func (c *SIGCache) SetReferenceGrant(obj *gatewayv1alpha2.ReferenceGrant) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if obj != nil {
+		c.ReferenceGrant[utils.Keyname(obj.Namespace, obj.Name)] = obj
+	}
+}
+
+func (c *SIGCache) UnsetReferenceGrant(keyname string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.ReferenceGrant, keyname)
+}
+
+// ReferenceGranted tells whether the gateway api object of fromKind in fromNs
+// is allowed to refer to the core object of toKind keyed by toKey.
+func (c *SIGCache) ReferenceGranted(fromKind, fromNs, toKind, toKey string) bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c._referenceGranted(fromKind, fromNs, toKind, toKey)
+}
+
+func (c *SIGCache) _referenceGranted(fromKind, fromNs, toKind, toKey string) bool {
+	nsn := strings.Split(toKey, "/")
+	if len(nsn) != 2 || nsn[0] == fromNs {
+		return true
+	}
+	for _, rg := range c.ReferenceGrant {
+		if rg.Namespace != nsn[0] {
+			continue
+		}
+		fromMatched := false
+		for _, from := range rg.Spec.From {
+			if from.Group == gatewayv1alpha2.GroupName && string(from.Kind) == fromKind && string(from.Namespace) == fromNs {
+				fromMatched = true
+				break
+			}
+		}
+		if !fromMatched {
+			continue
+		}
+		for _, to := range rg.Spec.To {
+			if to.Group == "" && string(to.Kind) == toKind && (to.Name == nil || string(*to.Name) == nsn[1]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *SIGCache) SetGRPCRoute(obj *gatewayv1alpha2.GRPCRoute) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if obj != nil {
+		c.GRPCRoute[utils.Keyname(obj.Namespace, obj.Name)] = obj
+	}
+}
+
+func (c *SIGCache) UnsetGRPCRoute(keyname string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.GRPCRoute, keyname)
+}
+
+func (c *SIGCache) GetGRPCRoute(keyname string) *gatewayv1alpha2.GRPCRoute {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.GRPCRoute[keyname]
+}
+
+// _httpRoutes returns the httproutes together with the ones converted from
+// the grpcroutes, which are parsed and deployed the same way.
+func (c *SIGCache) _httpRoutes() []*gatewayv1beta1.HTTPRoute {
+	hrs := []*gatewayv1beta1.HTTPRoute{}
+	for _, hr := range c.HTTPRoute {
+		hrs = append(hrs, hr)
+	}
+	for _, gr := range c.GRPCRoute {
+		hrs = append(hrs, httpRouteOfGRPC(gr))
+	}
+	return hrs
+}
+
+// GatewaysReferringNamespace returns the gateways whose listeners or attached
+// routes refer to the secrets or services in ns from other namespaces. They
+// are affected by the referencegrants in ns.
+func (c *SIGCache) GatewaysReferringNamespace(ns string) []*gatewayv1beta1.Gateway {
+	defer utils.TimeItToPrometheus()()
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	crossRefs := func(fromNs string, keys []string) bool {
+		for _, key := range keys {
+			if fromNs != ns && strings.HasPrefix(key, ns+"/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	gws := []*gatewayv1beta1.Gateway{}
+	for _, gw := range c.Gateway {
+		referring := false
+		for i := range gw.Spec.Listeners {
+			for _, ref := range certificateRefsOf(&gw.Spec.Listeners[i]) {
+				if ref.Namespace != nil && string(*ref.Namespace) == ns && gw.Namespace != ns {
+					referring = true
+				}
+			}
+		}
+		for _, hr := range c._attachedHTTPRoutes(gw) {
+			referring = referring || crossRefs(hr.Namespace, c._referredServiceKeys(hr))
+		}
+		for _, tr := range c._attachedTLSRoutes(gw) {
+			referring = referring || crossRefs(tr.Namespace, backendKeysOf(tr.Namespace, backendRefsOf(tr)))
+		}
+		for _, tcpr := range c._attachedTCPRoutes(gw) {
+			referring = referring || crossRefs(tcpr.Namespace, backendKeysOf(tcpr.Namespace, backendRefsOf(tcpr)))
+		}
+		for _, udpr := range c._attachedUDPRoutes(gw) {
+			referring = referring || crossRefs(udpr.Namespace, backendKeysOf(udpr.Namespace, backendRefsOf(udpr)))
+		}
+		if referring {
+			gws = append(gws, gw)
+		}
+	}
+	return gws
+}
+
+func (c *SIGCache) AttachedGateways(gtw *gatewayv1beta1.GatewayClass) []*gatewayv1beta1.Gateway {
+	defer utils.TimeItToPrometheus()()
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c._attachedGateways(gtw)
+}
+
+func (c *SIGCache) _attachedGateways(gwc *gatewayv1beta1.GatewayClass) []*gatewayv1beta1.Gateway {
+	if gwc == nil {
+		return []*gatewayv1beta1.Gateway{}
+	}
+
+	gws := []*gatewayv1beta1.Gateway{}
+	for _, gw := range c.Gateway {
+		if gw.Spec.GatewayClassName == gatewayv1beta1.ObjectName(gwc.Name) {
+			gws = append(gws, gw)
+		}
+	}
+	return gws
+}
+
+func (c *SIGCache) GatewayRefsOf(hr *gatewayv1beta1.HTTPRoute) []*gatewayv1beta1.Gateway {
+	defer utils.TimeItToPrometheus()()
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c._gatewayRefsOf(hr)
+}
+
+func (c *SIGCache) _gatewayRefsOf(hr *gatewayv1beta1.HTTPRoute) []*gatewayv1beta1.Gateway {
+	if hr == nil {
+		return []*gatewayv1beta1.Gateway{}
+	}
+	gws := []*gatewayv1beta1.Gateway{}
+	routetype := hrKind(hr)
+	for _, pr := range hr.Spec.ParentRefs {
+		ns := hr.Namespace
+		if pr.Namespace != nil {
+			ns = string(*pr.Namespace)
+		}
+		if gw, ok := c.Gateway[utils.Keyname(ns, string(pr.Name))]; ok {
+			if len(c._admittingListeners(gw, hr.Namespace, &pr, routetype)) > 0 {
+				gws = append(gws, gw)
+			}
+		}
+	}
+	return gws
+}
+
+func (c *SIGCache) GatewayRefsOfGRPCRoute(gr *gatewayv1alpha2.GRPCRoute) []*gatewayv1beta1.Gateway {
+	defer utils.TimeItToPrometheus()()
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	if gr == nil {
+		return []*gatewayv1beta1.Gateway{}
+	}
+	return c._gatewayRefsOf(httpRouteOfGRPC(gr))
+}
+
+func (c *SIGCache) GatewayRefsOfTLSRoute(tr *gatewayv1alpha2.TLSRoute) []*gatewayv1beta1.Gateway {
+	defer utils.TimeItToPrometheus()()
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c._gatewayRefsOfTLSRoute(tr)
+}
+
+func (c *SIGCache) _gatewayRefsOfTLSRoute(tr *gatewayv1alpha2.TLSRoute) []*gatewayv1beta1.Gateway {
+	if tr == nil {
+		return []*gatewayv1beta1.Gateway{}
+	}
+	return c._gatewayRefsOfParents(tr.Namespace, tr.Spec.ParentRefs, reflect.TypeOf(*tr).Name())
+}
+
+func (c *SIGCache) GatewayRefsOfTCPRoute(tcpr *gatewayv1alpha2.TCPRoute) []*gatewayv1beta1.Gateway {
+	defer utils.TimeItToPrometheus()()
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c._gatewayRefsOfTCPRoute(tcpr)
+}
+
+func (c *SIGCache) _gatewayRefsOfTCPRoute(tcpr *gatewayv1alpha2.TCPRoute) []*gatewayv1beta1.Gateway {
+	if tcpr == nil {
+		return []*gatewayv1beta1.Gateway{}
+	}
+	return c._gatewayRefsOfParents(tcpr.Namespace, tcpr.Spec.ParentRefs, reflect.TypeOf(*tcpr).Name())
+}
+
+func (c *SIGCache) GatewayRefsOfUDPRoute(udpr *gatewayv1alpha2.UDPRoute) []*gatewayv1beta1.Gateway {
+	defer utils.TimeItToPrometheus()()
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c._gatewayRefsOfUDPRoute(udpr)
+}
+
+func (c *SIGCache) _gatewayRefsOfUDPRoute(udpr *gatewayv1alpha2.UDPRoute) []*gatewayv1beta1.Gateway {
+	if udpr == nil {
+		return []*gatewayv1beta1.Gateway{}
+	}
+	return c._gatewayRefsOfParents(udpr.Namespace, udpr.Spec.ParentRefs, reflect.TypeOf(*udpr).Name())
+}
+
+// _gatewayRefsOfParents returns the gateways whose listeners accept the
+// v1alpha2 route of routetype in routeNs with the given parentRefs.
+func (c *SIGCache) _gatewayRefsOfParents(routeNs string, prs []gatewayv1alpha2.ParentReference, routetype string) []*gatewayv1beta1.Gateway {
+	gws := []*gatewayv1beta1.Gateway{}
+	for _, pr := range prs {
+		ns := routeNs
+		if pr.Namespace != nil {
+			ns = string(*pr.Namespace)
+		}
+		if gw, ok := c.Gateway[utils.Keyname(ns, string(pr.Name))]; ok {
+			bpr := betaParentRef(pr)
+			if len(c._admittingListeners(gw, routeNs, &bpr, routetype)) > 0 {
+				gws = append(gws, gw)
+			}
+		}
+	}
+	return gws
+}
+
+// _admittingListeners returns the listeners of gw selected by pr whose
+// allowedRoutes admit the route of routetype in routeNs.
+func (c *SIGCache) _admittingListeners(gw *gatewayv1beta1.Gateway, routeNs string, pr *gatewayv1beta1.ParentReference, routetype string) []*gatewayv1beta1.Listener {
+	listeners := []*gatewayv1beta1.Listener{}
+	for _, listener := range parentListeners(gw, routeNs, pr) {
+		if routeMatches(gw.Namespace, listener, c.Namespace[routeNs], routetype) {
+			listeners = append(listeners, listener)
+		}
+	}
+	return listeners
+}
+
+// _parentsAttachedTo tells whether the v1alpha2 route is attached to gw.
+func (c *SIGCache) _parentsAttachedTo(gw *gatewayv1beta1.Gateway, routeNs string, prs []gatewayv1alpha2.ParentReference, routetype string) bool {
+	for _, ng := range c._gatewayRefsOfParents(routeNs, prs, routetype) {
+		if utils.Keyname(ng.Namespace, ng.Name) == utils.Keyname(gw.Namespace, gw.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *SIGCache) AttachedHTTPRoutes(gw *gatewayv1beta1.Gateway) []*gatewayv1beta1.HTTPRoute {
+	defer utils.TimeItToPrometheus()()
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c._attachedHTTPRoutes(gw)
+}
+
+func (c *SIGCache) _attachedHTTPRoutes(gw *gatewayv1beta1.Gateway) []*gatewayv1beta1.HTTPRoute {
+	if gw == nil {
+		return []*gatewayv1beta1.HTTPRoute{}
+	}
+
+	hrs := []*gatewayv1beta1.HTTPRoute{}
+	for _, hr := range c._httpRoutes() {
+		routetype := hrKind(hr)
+		for _, pr := range hr.Spec.ParentRefs {
+			if len(c._admittingListeners(gw, hr.Namespace, &pr, routetype)) > 0 {
+				hrs = append(hrs, hr)
+				break
+			}
+		}
+	}
+	return hrs
+}
+
+func (c *SIGCache) AttachedTLSRoutes(gw *gatewayv1beta1.Gateway) []*gatewayv1alpha2.TLSRoute {
+	defer utils.TimeItToPrometheus()()
 
-	if eps != nil {
-		c.Endpoints[utils.Keyname(eps.Namespace, eps.Name)] = eps
-	}
-}
-func (c *SIGCache) UnsetEndpoints(keyname string) {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
 
-	delete(c.Endpoints, keyname)
+	return c._attachedTLSRoutes(gw)
 }
 
-func (c *SIGCache) SetService(svc *v1.Service) {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
-
-	if svc != nil {
-		c.Service[utils.Keyname(svc.Namespace, svc.Name)] = svc
+func (c *SIGCache) _attachedTLSRoutes(gw *gatewayv1beta1.Gateway) []*gatewayv1alpha2.TLSRoute {
+	if gw == nil {
+		return []*gatewayv1alpha2.TLSRoute{}
 	}
-}
-func (c *SIGCache) UnsetService(keyname string) {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
 
-	delete(c.Service, keyname)
+	trs := []*gatewayv1alpha2.TLSRoute{}
+	for _, tr := range c.TLSRoute {
+		if c._parentsAttachedTo(gw, tr.Namespace, tr.Spec.ParentRefs, reflect.TypeOf(*tr).Name()) {
+			trs = append(trs, tr)
+		}
+	}
+	return trs
 }
 
-func (c *SIGCache) AttachedGateways(gtw *gatewayv1beta1.GatewayClass) []*gatewayv1beta1.Gateway {
+func (c *SIGCache) AttachedTCPRoutes(gw *gatewayv1beta1.Gateway) []*gatewayv1alpha2.TCPRoute {
 	defer utils.TimeItToPrometheus()()
 
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
 
-	return c._attachedGateways(gtw)
+	return c._attachedTCPRoutes(gw)
 }
 
-func (c *SIGCache) _attachedGateways(gwc *gatewayv1beta1.GatewayClass) []*gatewayv1beta1.Gateway {
-	if gwc == nil {
-		return []*gatewayv1beta1.Gateway{}
+func (c *SIGCache) _attachedTCPRoutes(gw *gatewayv1beta1.Gateway) []*gatewayv1alpha2.TCPRoute {
+	if gw == nil {
+		return []*gatewayv1alpha2.TCPRoute{}
 	}
 
-	gws := []*gatewayv1beta1.Gateway{}
-	for _, gw := range c.Gateway {
-		if gw.Spec.GatewayClassName == gatewayv1beta1.ObjectName(gwc.Name) {
-			gws = append(gws, gw)
+	tcprs := []*gatewayv1alpha2.TCPRoute{}
+	for _, tcpr := range c.TCPRoute {
+		if c._parentsAttachedTo(gw, tcpr.Namespace, tcpr.Spec.ParentRefs, reflect.TypeOf(*tcpr).Name()) {
+			tcprs = append(tcprs, tcpr)
 		}
 	}
-	return gws
+	return tcprs
 }
 
-func (c *SIGCache) GatewayRefsOf(hr *gatewayv1beta1.HTTPRoute) []*gatewayv1beta1.Gateway {
+func (c *SIGCache) AttachedUDPRoutes(gw *gatewayv1beta1.Gateway) []*gatewayv1alpha2.UDPRoute {
 	defer utils.TimeItToPrometheus()()
 
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
 
-	return c._gatewayRefsOf(hr)
+	return c._attachedUDPRoutes(gw)
 }
 
-func (c *SIGCache) _gatewayRefsOf(hr *gatewayv1beta1.HTTPRoute) []*gatewayv1beta1.Gateway {
-	if hr == nil {
-		return []*gatewayv1beta1.Gateway{}
+func (c *SIGCache) _attachedUDPRoutes(gw *gatewayv1beta1.Gateway) []*gatewayv1alpha2.UDPRoute {
+	if gw == nil {
+		return []*gatewayv1alpha2.UDPRoute{}
 	}
-	gws := []*gatewayv1beta1.Gateway{}
-	for _, pr := range hr.Spec.ParentRefs {
-		ns := hr.Namespace
-		if pr.Namespace != nil {
-			ns = string(*pr.Namespace)
-		}
-		name := utils.Keyname(utils.Keyname(ns, string(pr.Name)))
-		if gw, ok := c.Gateway[name]; ok {
-			for _, listener := range gw.Spec.Listeners {
-				if listener.Name != *pr.SectionName {
-					continue
-				}
-				routetype := reflect.TypeOf(*hr).Name()
-				if routeMatches(gw.Namespace, &listener, ActiveSIGs.Namespace[hr.Namespace], routetype) {
-					gws = append(gws, gw)
-					break
-				}
-			}
 
+	udprs := []*gatewayv1alpha2.UDPRoute{}
+	for _, udpr := range c.UDPRoute {
+		if c._parentsAttachedTo(gw, udpr.Namespace, udpr.Spec.ParentRefs, reflect.TypeOf(*udpr).Name()) {
+			udprs = append(udprs, udpr)
 		}
 	}
-	return gws
+	return udprs
 }
 
-func (c *SIGCache) AttachedHTTPRoutes(gw *gatewayv1beta1.Gateway) []*gatewayv1beta1.HTTPRoute {
+// L4RoutesOfListeners returns the route of each TCP and UDP listener of gw,
+// keyed by the virtual names. The virtual forwards all the traffic to its
+// default pool, so if several routes attach to the same listener, the oldest
+// valid one wins.
+func (c *SIGCache) L4RoutesOfListeners(gw *gatewayv1beta1.Gateway) map[string]*l4Route {
 	defer utils.TimeItToPrometheus()()
 
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
 
-	return c._attachedHTTPRoutes(gw)
+	return c._l4RoutesOfListeners(gw)
 }
 
-func (c *SIGCache) _attachedHTTPRoutes(gw *gatewayv1beta1.Gateway) []*gatewayv1beta1.HTTPRoute {
-	if gw == nil {
-		return []*gatewayv1beta1.HTTPRoute{}
+func (c *SIGCache) _l4RoutesOfListeners(gw *gatewayv1beta1.Gateway) map[string]*l4Route {
+	routes := []*l4Route{}
+	for _, tcpr := range c._attachedTCPRoutes(gw) {
+		routes = append(routes, &l4Route{obj: tcpr, routetype: reflect.TypeOf(*tcpr).Name(), prs: tcpr.Spec.ParentRefs})
 	}
-
-	listeners := map[string]*gatewayv1beta1.Listener{}
-	// &listener, the local variable, will point to the latest listener
-	// it can be used but cannot be taken way.
-	// for _, listener := range gw.Spec.Listeners {  wrong!
-	for i := range gw.Spec.Listeners {
-		vsname := gwListenerName(gw, &gw.Spec.Listeners[i])
-		listeners[vsname] = &gw.Spec.Listeners[i]
+	for _, udpr := range c._attachedUDPRoutes(gw) {
+		routes = append(routes, &l4Route{obj: udpr, routetype: reflect.TypeOf(*udpr).Name(), prs: udpr.Spec.ParentRefs})
 	}
-
-	hrs := []*gatewayv1beta1.HTTPRoute{}
-	for _, hr := range ActiveSIGs.HTTPRoute {
-		for _, pr := range hr.Spec.ParentRefs {
-			ns := hr.Namespace
-			if pr.Namespace != nil {
-				ns = string(*pr.Namespace)
-			}
-			if utils.Keyname(ns, string(pr.Name)) == utils.Keyname(gw.Namespace, gw.Name) {
-				vsname := hrParentName(hr, &pr)
-				routeNamespace := ActiveSIGs.Namespace[hr.Namespace]
-				routetype := reflect.TypeOf(*hr).Name()
-				if routeMatches(gw.Namespace, listeners[vsname], routeNamespace, routetype) {
-					hrs = append(hrs, hr)
-					break
+	sort.Slice(routes, func(i, j int) bool {
+		return olderThan(routes[i].obj, routes[j].obj)
+	})
+
+	winners := map[string]*l4Route{}
+	for _, route := range routes {
+		routeNs := route.obj.GetNamespace()
+		svcKey, err := l4BackendOf(routeNs, backendRefsOf(route.obj))
+		if err != nil || !c._referenceGranted(route.routetype, routeNs, "Service", svcKey) {
+			continue
+		}
+		route.svcKey = svcKey
+		for _, pr := range route.prs {
+			bpr := betaParentRef(pr)
+			for _, listener := range c._admittingListeners(gw, routeNs, &bpr, route.routetype) {
+				vsname := gwListenerName(gw, listener)
+				if _, ok := winners[vsname]; !ok {
+					winners[vsname] = route
 				}
 			}
 		}
 	}
-	return hrs
+	return winners
+}
+
+// _l4ConflictOf returns the message if the tcproute or udproute loses all the
+// listeners of gw selected by pr to the older routes, or "".
+func (c *SIGCache) _l4ConflictOf(gw *gatewayv1beta1.Gateway, route client.Object, pr *gatewayv1beta1.ParentReference, routetype string) string {
+	winners := c._l4RoutesOfListeners(gw)
+	msgs := []string{}
+	for _, listener := range c._admittingListeners(gw, route.GetNamespace(), pr, routetype) {
+		if listener.Protocol != gatewayv1beta1.TCPProtocolType && listener.Protocol != gatewayv1beta1.UDPProtocolType {
+			return ""
+		}
+		winner, ok := winners[gwListenerName(gw, listener)]
+		if !ok || (winner.routetype == routetype &&
+			utils.Keyname(winner.obj.GetNamespace(), winner.obj.GetName()) == utils.Keyname(route.GetNamespace(), route.GetName())) {
+			return ""
+		}
+		msgs = append(msgs, fmt.Sprintf("listener '%s' is taken by the older %s '%s'", listener.Name,
+			winner.routetype, utils.Keyname(winner.obj.GetNamespace(), winner.obj.GetName())))
+	}
+	return strings.Join(msgs, "; ")
 }
 
 func (c *SIGCache) AttachedServices(hr *gatewayv1beta1.HTTPRoute) []*v1.Service {
@@ -296,7 +1011,11 @@ func (c *SIGCache) _attachedServices(hr *gatewayv1beta1.HTTPRoute) []*v1.Service
 			if br.Namespace != nil {
 				ns = string(*br.Namespace)
 			}
-			if svc, ok := c.Service[utils.Keyname(ns, string(br.Name))]; ok {
+			key := utils.Keyname(ns, string(br.Name))
+			if !c._referenceGranted(hrKind(hr), hr.Namespace, "Service", key) {
+				continue
+			}
+			if svc, ok := c.Service[key]; ok {
 				svcs = append(svcs, svc)
 			}
 		}
@@ -311,29 +1030,61 @@ func (c *SIGCache) _attachedServices(hr *gatewayv1beta1.HTTPRoute) []*v1.Service
 					}
 				}
 			}
+			if key := mirrorKeyOf(hr, &fl); key != "" && c._referenceGranted(hrKind(hr), hr.Namespace, "Service", key) {
+				if svc, ok := c.Service[key]; ok {
+					svcs = append(svcs, svc)
+				}
+			}
 		}
 	}
 	return svcs
 }
 
-func (c *SIGCache) AllAttachedServiceKeys() []string {
+// AttachedServiceKeysByBackendPartition returns the services referred by the routes
+// of each backend partition. The default backend partition is always included
+// so that its pools are removed when no longer referred.
+func (c *SIGCache) AttachedServiceKeysByBackendPartition() map[string][]string {
 	defer utils.TimeItToPrometheus()()
 
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
 
-	svcs := []string{}
+	partitions := map[string][]string{c.BackendPartition: {}}
 	for _, gwc := range c.GatewayClass {
+		svcs := []string{}
 		for _, gw := range c._attachedGateways(gwc) {
 			for _, hr := range c._attachedHTTPRoutes(gw) {
 				svcs = append(svcs, c._attachedServiceKeys(hr)...)
 			}
+			for _, tr := range c._attachedTLSRoutes(gw) {
+				svcs = append(svcs, c._tlsRouteServiceKeys(tr)...)
+			}
+			for _, tcpr := range c._attachedTCPRoutes(gw) {
+				svcs = append(svcs, c._tcpRouteServiceKeys(tcpr)...)
+			}
+			for _, udpr := range c._attachedUDPRoutes(gw) {
+				svcs = append(svcs, c._udpRouteServiceKeys(udpr)...)
+			}
 		}
+		partition := c._backendPartitionOfClass(gwc.Name)
+		partitions[partition] = append(partitions[partition], svcs...)
 	}
-	return svcs
+	return partitions
 }
 
+// _attachedServiceKeys returns the services referred by hr, the ones in
+// other namespaces which are not granted are excluded.
 func (c *SIGCache) _attachedServiceKeys(hr *gatewayv1beta1.HTTPRoute) []string {
+	svcs := []string{}
+	for _, key := range c._referredServiceKeys(hr) {
+		if c._referenceGranted(hrKind(hr), hr.Namespace, "Service", key) {
+			svcs = append(svcs, key)
+		}
+	}
+	return svcs
+}
+
+func (c *SIGCache) _referredServiceKeys(hr *gatewayv1beta1.HTTPRoute) []string {
 	if hr == nil {
 		return []string{}
 	}
@@ -356,19 +1107,62 @@ func (c *SIGCache) _attachedServiceKeys(hr *gatewayv1beta1.HTTPRoute) []string {
 					svcs = append(svcs, utils.Keyname(hr.Namespace, string(er.Name)))
 				}
 			}
+			if key := mirrorKeyOf(hr, &fl); key != "" {
+				svcs = append(svcs, key)
+			}
 		}
 	}
 
 	return utils.Unified(svcs)
 }
 
+func (c *SIGCache) _tlsRouteServiceKeys(tr *gatewayv1alpha2.TLSRoute) []string {
+	if tr == nil {
+		return []string{}
+	}
+	return c._grantedBackendKeys(tr)
+}
+
+func (c *SIGCache) _tcpRouteServiceKeys(tcpr *gatewayv1alpha2.TCPRoute) []string {
+	if tcpr == nil {
+		return []string{}
+	}
+	return c._grantedBackendKeys(tcpr)
+}
+
+func (c *SIGCache) _udpRouteServiceKeys(udpr *gatewayv1alpha2.UDPRoute) []string {
+	if udpr == nil {
+		return []string{}
+	}
+	return c._grantedBackendKeys(udpr)
+}
+
+// _grantedBackendKeys returns the services referred by the v1alpha2 route
+// which are in the same namespace or granted.
+func (c *SIGCache) _grantedBackendKeys(route client.Object) []string {
+	routetype := reflect.TypeOf(route).Elem().Name()
+	svcs := []string{}
+	for _, key := range backendKeysOf(route.GetNamespace(), backendRefsOf(route)) {
+		if c._referenceGranted(routetype, route.GetNamespace(), "Service", key) {
+			svcs = append(svcs, key)
+		}
+	}
+	return utils.Unified(svcs)
+}
+
 func (c *SIGCache) HTTPRoutesRefsOf(svc *v1.Service) []*gatewayv1beta1.HTTPRoute {
 	defer utils.TimeItToPrometheus()()
 
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
 
-	return c._HTTPRoutesRefsOf(svc)
+	hrs := []*gatewayv1beta1.HTTPRoute{}
+	for _, hr := range c._HTTPRoutesRefsOf(svc) {
+		if hrKind(hr) != grpcRouteKind {
+			hrs = append(hrs, hr)
+		}
+	}
+	return hrs
 }
 
 func (c *SIGCache) _HTTPRoutesRefsOf(svc *v1.Service) []*gatewayv1beta1.HTTPRoute {
@@ -398,25 +1192,135 @@ func (c *SIGCache) _HTTPRoutesRefsOf(svc *v1.Service) []*gatewayv1beta1.HTTPRout
 						}
 					}
 				}
+				if mirrorKeyOf(hr, &fl) == utils.Keyname(svc.Namespace, svc.Name) {
+					return true
+				}
 			}
 		}
 		return false
 	}
 
-	hrKeys := []string{}
-	for _, hr := range c.HTTPRoute {
+	hrs := []*gatewayv1beta1.HTTPRoute{}
+	for _, hr := range c._httpRoutes() {
 		if refered(hr) {
-			hrKeys = append(hrKeys, utils.Keyname(hr.Namespace, hr.Name))
+			hrs = append(hrs, hr)
 		}
 	}
-	hrKeys = utils.Unified(hrKeys)
+	return hrs
+}
 
-	hrs := []*gatewayv1beta1.HTTPRoute{}
-	for _, hrk := range hrKeys {
-		hrs = append(hrs, c.HTTPRoute[hrk])
+func (c *SIGCache) GRPCRoutesRefsOf(svc *v1.Service) []*gatewayv1alpha2.GRPCRoute {
+	defer utils.TimeItToPrometheus()()
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	grs := []*gatewayv1alpha2.GRPCRoute{}
+	for _, hr := range c._HTTPRoutesRefsOf(svc) {
+		if hrKind(hr) == grpcRouteKind {
+			grs = append(grs, c.GRPCRoute[utils.Keyname(hr.Namespace, hr.Name)])
+		}
 	}
+	return grs
+}
 
-	return hrs
+func (c *SIGCache) TLSRoutesRefsOf(svc *v1.Service) []*gatewayv1alpha2.TLSRoute {
+	defer utils.TimeItToPrometheus()()
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c._TLSRoutesRefsOf(svc)
+}
+
+func (c *SIGCache) _TLSRoutesRefsOf(svc *v1.Service) []*gatewayv1alpha2.TLSRoute {
+	if svc == nil {
+		return []*gatewayv1alpha2.TLSRoute{}
+	}
+
+	trs := []*gatewayv1alpha2.TLSRoute{}
+	for _, tr := range c.TLSRoute {
+		if contains(c._tlsRouteServiceKeys(tr), utils.Keyname(svc.Namespace, svc.Name)) {
+			trs = append(trs, tr)
+		}
+	}
+	return trs
+}
+
+func (c *SIGCache) TCPRoutesRefsOf(svc *v1.Service) []*gatewayv1alpha2.TCPRoute {
+	defer utils.TimeItToPrometheus()()
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c._TCPRoutesRefsOf(svc)
+}
+
+func (c *SIGCache) _TCPRoutesRefsOf(svc *v1.Service) []*gatewayv1alpha2.TCPRoute {
+	if svc == nil {
+		return []*gatewayv1alpha2.TCPRoute{}
+	}
+
+	tcprs := []*gatewayv1alpha2.TCPRoute{}
+	for _, tcpr := range c.TCPRoute {
+		if contains(c._tcpRouteServiceKeys(tcpr), utils.Keyname(svc.Namespace, svc.Name)) {
+			tcprs = append(tcprs, tcpr)
+		}
+	}
+	return tcprs
+}
+
+func (c *SIGCache) UDPRoutesRefsOf(svc *v1.Service) []*gatewayv1alpha2.UDPRoute {
+	defer utils.TimeItToPrometheus()()
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c._UDPRoutesRefsOf(svc)
+}
+
+func (c *SIGCache) _UDPRoutesRefsOf(svc *v1.Service) []*gatewayv1alpha2.UDPRoute {
+	if svc == nil {
+		return []*gatewayv1alpha2.UDPRoute{}
+	}
+
+	udprs := []*gatewayv1alpha2.UDPRoute{}
+	for _, udpr := range c.UDPRoute {
+		if contains(c._udpRouteServiceKeys(udpr), utils.Keyname(svc.Namespace, svc.Name)) {
+			udprs = append(udprs, udpr)
+		}
+	}
+	return udprs
+}
+
+// GatewayRefsOfSecret returns the gateways whose listeners refer the secret as certificate.
+func (c *SIGCache) GatewayRefsOfSecret(keyname string) []*gatewayv1beta1.Gateway {
+	defer utils.TimeItToPrometheus()()
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	gws := []*gatewayv1beta1.Gateway{}
+	for _, gw := range c.Gateway {
+		for _, listener := range gw.Spec.Listeners {
+			found := false
+			for _, ref := range certificateRefsOf(&listener) {
+				ns := gw.Namespace
+				if ref.Namespace != nil {
+					ns = string(*ref.Namespace)
+				}
+				if utils.Keyname(ns, string(ref.Name)) == keyname {
+					found = true
+					break
+				}
+			}
+			if found {
+				gws = append(gws, gw)
+				break
+			}
+		}
+	}
+	return gws
 }
 
 // GetNeighborGateways get neighbor gateways(itself is not included) for all gateway class.
@@ -437,6 +1341,21 @@ func (c *SIGCache) GetNeighborGateways(gw *gatewayv1beta1.Gateway) []*gatewayv1b
 			}
 		}
 	}
+	for _, tr := range c._attachedTLSRoutes(gw) {
+		for _, ng := range c._gatewayRefsOfTLSRoute(tr) {
+			gwmap[utils.Keyname(ng.Namespace, ng.Name)] = ng
+		}
+	}
+	for _, tcpr := range c._attachedTCPRoutes(gw) {
+		for _, ng := range c._gatewayRefsOfTCPRoute(tcpr) {
+			gwmap[utils.Keyname(ng.Namespace, ng.Name)] = ng
+		}
+	}
+	for _, udpr := range c._attachedUDPRoutes(gw) {
+		for _, ng := range c._gatewayRefsOfUDPRoute(udpr) {
+			gwmap[utils.Keyname(ng.Namespace, ng.Name)] = ng
+		}
+	}
 
 	delete(gwmap, utils.Keyname(gw.Namespace, gw.Name))
 	rlt := []*gatewayv1beta1.Gateway{}
@@ -447,6 +1366,35 @@ func (c *SIGCache) GetNeighborGateways(gw *gatewayv1beta1.Gateway) []*gatewayv1b
 	return rlt
 }
 
+// ServiceKeysRefsOfBackendTLS returns the keys of the attached services whose
+// backend TLS refers to the ConfigMap or Secret of kind.
+func (c *SIGCache) ServiceKeysRefsOfBackendTLS(kind, keyname string) []string {
+	defer utils.TimeItToPrometheus()()
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	keys := []string{}
+	for _, gwc := range c.GatewayClass {
+		for _, gw := range c._attachedGateways(gwc) {
+			for _, hr := range c._attachedHTTPRoutes(gw) {
+				for _, svckey := range c._attachedServiceKeys(hr) {
+					svc := c.Service[svckey]
+					if svc == nil || contains(keys, svckey) {
+						continue
+					}
+					for _, ref := range backendTLSRefsOf(svc) {
+						if ref == kind+"/"+keyname {
+							keys = append(keys, svckey)
+						}
+					}
+				}
+			}
+		}
+	}
+	return keys
+}
+
 func (c *SIGCache) GetRootGateways(svcs []*v1.Service) []*gatewayv1beta1.Gateway {
 	defer utils.TimeItToPrometheus()()
 
@@ -463,6 +1411,21 @@ func (c *SIGCache) GetRootGateways(svcs []*v1.Service) []*gatewayv1beta1.Gateway
 				gwmap[utils.Keyname(gw.Namespace, gw.Name)] = gw
 			}
 		}
+		for _, tr := range c._TLSRoutesRefsOf(svc) {
+			for _, gw := range c._gatewayRefsOfTLSRoute(tr) {
+				gwmap[utils.Keyname(gw.Namespace, gw.Name)] = gw
+			}
+		}
+		for _, tcpr := range c._TCPRoutesRefsOf(svc) {
+			for _, gw := range c._gatewayRefsOfTCPRoute(tcpr) {
+				gwmap[utils.Keyname(gw.Namespace, gw.Name)] = gw
+			}
+		}
+		for _, udpr := range c._UDPRoutesRefsOf(svc) {
+			for _, gw := range c._gatewayRefsOfUDPRoute(udpr) {
+				gwmap[utils.Keyname(gw.Namespace, gw.Name)] = gw
+			}
+		}
 	}
 	rlt := []*gatewayv1beta1.Gateway{}
 	for _, gw := range gwmap {
@@ -497,6 +1460,31 @@ func (c *SIGCache) syncCoreV1Resources(mgr manager.Manager) error {
 		}
 	}
 
+	// the same secrets and configmaps as the ones watched.
+	if scrtList, err := kubeClient.CoreV1().Secrets(v1.NamespaceAll).List(context.TODO(), metav1.ListOptions{}); err != nil {
+		return err
+	} else {
+		for _, scrt := range scrtList.Items {
+			if !SecretReferable(&scrt) {
+				continue
+			}
+			slog.Debugf("found secret %s", utils.Keyname(scrt.Namespace, scrt.Name))
+			c.Secret[utils.Keyname(scrt.Namespace, scrt.Name)] = scrt.DeepCopy()
+		}
+	}
+
+	if cmList, err := kubeClient.CoreV1().ConfigMaps(v1.NamespaceAll).List(context.TODO(), metav1.ListOptions{}); err != nil {
+		return err
+	} else {
+		for _, cm := range cmList.Items {
+			if !ConfigMapReferable(&cm) {
+				continue
+			}
+			slog.Debugf("found configmap %s", utils.Keyname(cm.Namespace, cm.Name))
+			c.ConfigMap[utils.Keyname(cm.Namespace, cm.Name)] = cm.DeepCopy()
+		}
+	}
+
 	if nsList, err := kubeClient.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{}); err != nil {
 		return nil
 	} else {
@@ -579,10 +1567,90 @@ func (c *SIGCache) syncGatewayResources(mgr manager.Manager) error {
 			c.HTTPRoute[utils.Keyname(hr.Namespace, hr.Name)] = hr.DeepCopy()
 		}
 	}
+
+	// TLSRoute, GRPCRoute, TCPRoute, UDPRoute and ReferenceGrant are experimental, their CRDs may be not installed.
+	var trList gatewayv1alpha2.TLSRouteList
+	if err := mgr.GetCache().List(context.TODO(), &trList, &client.ListOptions{}); err != nil {
+		if !meta.IsNoMatchError(err) {
+			return err
+		}
+		slog.Debugf("tlsroutes are not synced: %s", err.Error())
+	} else {
+		for _, tr := range trList.Items {
+			slog.Debugf("found tlsroute %s", utils.Keyname(tr.Namespace, tr.Name))
+			c.TLSRoute[utils.Keyname(tr.Namespace, tr.Name)] = tr.DeepCopy()
+		}
+	}
+	var grList gatewayv1alpha2.GRPCRouteList
+	if err := mgr.GetCache().List(context.TODO(), &grList, &client.ListOptions{}); err != nil {
+		if !meta.IsNoMatchError(err) {
+			return err
+		}
+		slog.Debugf("grpcroutes are not synced: %s", err.Error())
+	} else {
+		for _, gr := range grList.Items {
+			slog.Debugf("found grpcroute %s", utils.Keyname(gr.Namespace, gr.Name))
+			c.GRPCRoute[utils.Keyname(gr.Namespace, gr.Name)] = gr.DeepCopy()
+		}
+	}
+	var tcprList gatewayv1alpha2.TCPRouteList
+	if err := mgr.GetCache().List(context.TODO(), &tcprList, &client.ListOptions{}); err != nil {
+		if !meta.IsNoMatchError(err) {
+			return err
+		}
+		slog.Debugf("tcproutes are not synced: %s", err.Error())
+	} else {
+		for _, tcpr := range tcprList.Items {
+			slog.Debugf("found tcproute %s", utils.Keyname(tcpr.Namespace, tcpr.Name))
+			c.TCPRoute[utils.Keyname(tcpr.Namespace, tcpr.Name)] = tcpr.DeepCopy()
+		}
+	}
+	var udprList gatewayv1alpha2.UDPRouteList
+	if err := mgr.GetCache().List(context.TODO(), &udprList, &client.ListOptions{}); err != nil {
+		if !meta.IsNoMatchError(err) {
+			return err
+		}
+		slog.Debugf("udproutes are not synced: %s", err.Error())
+	} else {
+		for _, udpr := range udprList.Items {
+			slog.Debugf("found udproute %s", utils.Keyname(udpr.Namespace, udpr.Name))
+			c.UDPRoute[utils.Keyname(udpr.Namespace, udpr.Name)] = udpr.DeepCopy()
+		}
+	}
+	// The CRD of BIGIPGatewayClassParameters may be not installed either.
+	paramsList := unstructured.UnstructuredList{}
+	paramsList.SetGroupVersionKind(ClassParametersGVK().GroupVersion().WithKind(ClassParametersKind + "List"))
+	if err := mgr.GetCache().List(context.TODO(), &paramsList, &client.ListOptions{}); err != nil {
+		if !meta.IsNoMatchError(err) {
+			return err
+		}
+		slog.Debugf("gatewayclass parameters are not synced: %s", err.Error())
+	} else {
+		for i := range paramsList.Items {
+			params, err := ClassParametersFromUnstructured(&paramsList.Items[i])
+			if err != nil {
+				return err
+			}
+			slog.Debugf("found gatewayclass parameters %s", utils.Keyname(params.Namespace, params.Name))
+			c.ClassParameters[utils.Keyname(params.Namespace, params.Name)] = params
+		}
+	}
+	var rgList gatewayv1alpha2.ReferenceGrantList
+	if err := mgr.GetCache().List(context.TODO(), &rgList, &client.ListOptions{}); err != nil {
+		if !meta.IsNoMatchError(err) {
+			return err
+		}
+		slog.Debugf("referencegrants are not synced: %s", err.Error())
+	} else {
+		for _, rg := range rgList.Items {
+			slog.Debugf("found referencegrant %s", utils.Keyname(rg.Namespace, rg.Name))
+			c.ReferenceGrant[utils.Keyname(rg.Namespace, rg.Name)] = rg.DeepCopy()
+		}
+	}
 	return nil
 }
 
-func (c *SIGCache) SyncAllResources(mgr manager.Manager) {
+func (c *SIGCache) SyncAllResources(mgr manager.Manager) error {
 	defer utils.TimeItToPrometheus()()
 
 	c.mutex.Lock()
@@ -595,8 +1663,11 @@ func (c *SIGCache) SyncAllResources(mgr manager.Manager) {
 	}
 	if err := c.syncGatewayResources(mgr); err != nil {
 		slog.Errorf("failed to sync gateway api resources to local: %s", err.Error())
+		c.SyncedAtStart = true
+		return err
 	}
 
 	slog.Infof("Finished syncing resources to local")
 	c.SyncedAtStart = true
+	return nil
 }
@@ -1,7 +1,12 @@
 package pkg
 
 import (
+	"context"
 	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
 
 	f5_bigip "gitee.com/zongzw/f5-bigip-rest/bigip"
 	"gitee.com/zongzw/f5-bigip-rest/utils"
@@ -17,7 +22,26 @@ func deploy(bc *f5_bigip.BIGIPContext, partition string, ocfgs, ncfgs *map[strin
 	return bc.DoRestRequests(cmds)
 }
 
+// Deployer dispatches the requests to the deploy workers of the BIG-IPs, so that
+// a slow or unreachable BIG-IP does not block the others. The StatusFunc of a
+// request is called once all its BIG-IPs are done, by the status queue.
 func Deployer(stopCh chan struct{}, bigips []*f5_bigip.BIGIP) {
+	go statusReports.run(stopCh)
+
+	workers := []*deployWorker{}
+	for _, bigip := range bigips {
+		w := &deployWorker{
+			bigip:     bigip,
+			queue:     []*deployJob{},
+			signal:    make(chan struct{}, 1),
+			failing:   map[string]int{},
+			abandoned: map[string]bool{},
+		}
+		OutOfSyncPartitions.WithLabelValues(bigip.URL).Set(0)
+		workers = append(workers, w)
+		go w.run(stopCh)
+	}
+
 	for {
 		select {
 		case <-stopCh:
@@ -25,48 +49,459 @@ func Deployer(stopCh chan struct{}, bigips []*f5_bigip.BIGIP) {
 		case r := <-PendingDeploys:
 			slog := utils.LogFromContext(r.Context)
 			slog.Debugf("Processing request: %s", r.Meta)
-			done := make(chan bool)
-			for _, bigip := range bigips {
-				specified := r.Context.Value(CtxKey_SpecifiedBIGIP)
-				if specified != nil && specified.(string) != bigip.URL {
+
+			targets := []*deployWorker{}
+			specified := r.Context.Value(CtxKey_SpecifiedBIGIP)
+			for _, w := range workers {
+				if specified != nil && specified.(string) != w.bigip.URL {
 					continue
 				}
-				bc := &f5_bigip.BIGIPContext{BIGIP: *bigip, Context: r.Context}
-				go func(bc *f5_bigip.BIGIPContext, r DeployRequest) {
-					defer func() { done <- true }()
-
-					if r.Context.Value(CtxKey_CreatePartition) != nil {
-						if err := bc.DeployPartition(r.Partition); err != nil {
-							slog.Errorf("failed to deploy partition %s: %s", r.Partition, err.Error())
-							return
-						}
-					}
-					err := deploy(bc, r.Partition, r.From, r.To)
-					if err != nil {
-						// report the error to status or ...
-						slog.Errorf("failed to do deployment to %s: %s", bc.URL, err.Error())
-						return
-					}
-					if r.Context.Value(CtxKey_DeletePartition) != nil {
-						if err := bc.DeletePartition(r.Partition); err != nil {
-							slog.Errorf("failed to deploy partition %s: %s", r.Partition, err.Error())
-							return
-						}
-					}
-					r.StatusFunc()
-				}(bc, r)
+				targets = append(targets, w)
+			}
+			if len(targets) == 0 {
+				reportStatus(r.StatusFunc, nil)
+				continue
+			}
+			collector := &deployCollector{request: r, pending: len(targets), failed: map[string]error{}}
+			for _, w := range targets {
+				w.enqueue(&deployJob{request: r, collector: collector, enqueuedAt: time.Now()})
+			}
+		}
+	}
+}
+
+// enqueue never blocks, the requests of the BIG-IP are kept in order.
+func (w *deployWorker) enqueue(job *deployJob) {
+	w.mutex.Lock()
+	w.queue = append(w.queue, job)
+	w.mutex.Unlock()
+
+	select {
+	case w.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (w *deployWorker) head() *deployJob {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if len(w.queue) == 0 {
+		return nil
+	}
+	return w.queue[0]
+}
+
+// dequeue takes the head job together with the jobs of the same partition
+// following it, which can be deployed as one. The jobs of other partitions
+// are not skipped over, so that the order across partitions is kept, e.g.
+// the pools are created before the rules referring them.
+func (w *deployWorker) dequeue() []*deployJob {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	n := 0
+	for n < len(w.queue) && (n == 0 || mergeable(w.queue[0].request, w.queue[n].request)) {
+		n++
+	}
+	jobs := w.queue[:n]
+	w.queue = w.queue[n:]
+	return jobs
+}
+
+func (w *deployWorker) run(stopCh chan struct{}) {
+	for {
+		job := w.head()
+		if job == nil {
+			select {
+			case <-stopCh:
+				return
+			case <-w.signal:
+			}
+			continue
+		}
+		// let the bursts of requests collapse before deploying.
+		if wait := DeployDebounce - time.Since(job.enqueuedAt); wait > 0 {
+			select {
+			case <-stopCh:
+				return
+			case <-time.After(wait):
 			}
-			for _, bigip := range bigips {
-				specified := r.Context.Value(CtxKey_SpecifiedBIGIP)
-				if specified != nil && specified.(string) != bigip.URL {
+		}
+
+		jobs := w.dequeue()
+		r := mergeRequests(w.refresh(jobs))
+		if len(jobs) > 1 {
+			utils.LogFromContext(r.Context).Debugf("merged %d requests to %s: %s", len(jobs), w.bigip.URL, r.Meta)
+		}
+		err := w.deploy(r)
+		for _, job := range jobs {
+			w.settle(job, err)
+		}
+	}
+}
+
+// refresh returns the jobs with the To of the retried and the given up ones
+// recomputed against the latest desired state, rather than the stale one.
+func (w *deployWorker) refresh(jobs []*deployJob) []*deployJob {
+	refreshed := []*deployJob{}
+	for _, job := range jobs {
+		retried := job.attempt > 0 || job.request.Context.Value(CtxKey_GivenUpRequest) != nil
+		if !retried || job.request.Context.Value(CtxKey_DeletePartition) != nil {
+			refreshed = append(refreshed, job)
+			continue
+		}
+		slog := utils.LogFromContext(job.request.Context)
+		desired, err := desiredConfigsOf(job.request.Partition, w.bigip.URL)
+		if err != nil {
+			slog.Errorf("unable to recompute the retry of '%s', retry as it is: %s", job.request.Meta, err.Error())
+			refreshed = append(refreshed, job)
+			continue
+		}
+		to := map[string]interface{}{}
+		mergeResources(to, map[string]bool{}, job.request.From, job.request.To, desired)
+		rjob := *job
+		rjob.request.To = &to
+		refreshed = append(refreshed, &rjob)
+	}
+	return refreshed
+}
+
+// settle takes the result of the job, the failed one is requeued with backoff
+// until DeployMaxRetries, after which it's given up and reported for the
+// object to requeue it.
+func (w *deployWorker) settle(job *deployJob, err error) {
+	slog := utils.LogFromContext(job.request.Context)
+	partition := job.request.Partition
+
+	if err == nil {
+		if job.attempt > 0 {
+			w.failing[partition]--
+			slog.Infof("deployment '%s' to %s succeeded after %d retries", job.request.Meta, w.bigip.URL, job.attempt)
+		}
+		delete(w.abandoned, partition)
+		job.collector.done(w.bigip.URL, nil, job.attempt == 0, false)
+	} else if job.attempt >= DeployMaxRetries {
+		w.failing[partition]--
+		w.abandoned[partition] = true
+		slog.Errorf("gave up deployment '%s' to %s after %d retries: %s", job.request.Meta, w.bigip.URL, job.attempt, err.Error())
+		job.collector.done(w.bigip.URL, err, false, true)
+	} else {
+		if job.attempt == 0 {
+			w.failing[partition]++
+		}
+		delay := retryDelayOf(job.attempt + 1)
+		slog.Infof("retry deployment '%s' to %s in %s", job.request.Meta, w.bigip.URL, delay.String())
+		retry := &deployJob{request: job.request, collector: job.collector, attempt: job.attempt + 1}
+		time.AfterFunc(delay, func() {
+			retry.enqueuedAt = time.Now()
+			w.enqueue(retry)
+		})
+		job.collector.done(w.bigip.URL, err, job.attempt == 0, false)
+	}
+
+	outOfSync := 0
+	for p := range w.failing {
+		if w.failing[p] > 0 || w.abandoned[p] {
+			outOfSync++
+		} else {
+			delete(w.failing, p)
+		}
+	}
+	for p := range w.abandoned {
+		if _, ok := w.failing[p]; !ok {
+			outOfSync++
+		}
+	}
+	OutOfSyncPartitions.WithLabelValues(w.bigip.URL).Set(float64(outOfSync))
+}
+
+// retryDelayOf returns the exponential backoff of the attempt with jitter,
+// which is between the half and the whole of the backoff.
+func retryDelayOf(attempt int) time.Duration {
+	backoff := DeployRetryBaseDelay << (attempt - 1)
+	if backoff > DeployRetryMaxDelay || backoff <= 0 {
+		backoff = DeployRetryMaxDelay
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// desiredConfigsOf returns the latest configs of the partition on the BIG-IP
+// parsed from the cache, nil if the partition is no longer used.
+func desiredConfigsOf(partition, url string) (*map[string]interface{}, error) {
+	if partition == "Common" {
+		for i, bc := range BIPConfigs {
+			if bc.Management == nil {
+				continue
+			}
+			port := 443
+			if bc.Management.Port != nil {
+				port = *bc.Management.Port
+			}
+			if fmt.Sprintf("https://%s:%d", bc.Management.IpAddress, port) == url {
+				cfgs, err := ParseNodeConfigs(&BIPConfigs[i])
+				return &cfgs, err
+			}
+		}
+		return nil, fmt.Errorf("no config found for %s", url)
+	}
+	if gwc := ActiveSIGs.ClassOfPartition(partition); gwc != nil {
+		cfgs, err := ParseGatewayRelatedForClass(gwc.Name, ActiveSIGs.AttachedGateways(gwc))
+		return &cfgs, err
+	}
+	pcfgs, err := ParseServicesRelatedForAll()
+	if err != nil {
+		return nil, err
+	}
+	if cfgs, ok := pcfgs[partition]; ok {
+		return &cfgs, nil
+	}
+	return nil, nil
+}
+
+// mergeable tells whether b can be merged into a. The partition deletions are
+// never merged as nothing can follow them.
+func mergeable(a, b DeployRequest) bool {
+	return a.Partition == b.Partition &&
+		a.Context.Value(CtxKey_DeletePartition) == nil &&
+		b.Context.Value(CtxKey_DeletePartition) == nil
+}
+
+// mergeRequests merges the requests of a partition into one, the From of each
+// resource is the one of the earliest request referring it, and the To is the
+// one of the latest request.
+func mergeRequests(jobs []*deployJob) DeployRequest {
+	first := jobs[0].request
+	if len(jobs) == 1 {
+		return first
+	}
+
+	ctx := first.Context
+	from, to := map[string]interface{}{}, map[string]interface{}{}
+	fromDecided, toDecided := map[string]bool{}, map[string]bool{}
+	for i := range jobs {
+		r, l := jobs[i].request, jobs[len(jobs)-1-i].request
+		if r.Context.Value(CtxKey_CreatePartition) != nil {
+			ctx = context.WithValue(ctx, CtxKey_CreatePartition, "yes")
+		}
+		// earliest first for From
+		mergeResources(from, fromDecided, r.From, r.To, r.From)
+		// latest first for To
+		mergeResources(to, toDecided, l.From, l.To, l.To)
+	}
+
+	return DeployRequest{
+		Meta:      fmt.Sprintf("%s (merged with %d more requests)", first.Meta, len(jobs)-1),
+		From:      &from,
+		To:        &to,
+		Partition: first.Partition,
+		Context:   ctx,
+	}
+}
+
+// mergeResources sets the resources referred by ocfgs or ncfgs to dst, from
+// the ones in src, unless they are decided by the previous requests.
+// The resources absent in src are decided as absent.
+func mergeResources(dst map[string]interface{}, decided map[string]bool, ocfgs, ncfgs, src *map[string]interface{}) {
+	for _, cfgs := range []*map[string]interface{}{ocfgs, ncfgs} {
+		if cfgs == nil {
+			continue
+		}
+		for folder, resources := range *cfgs {
+			if _, ok := dst[folder]; !ok {
+				dst[folder] = map[string]interface{}{}
+			}
+			for key := range resources.(map[string]interface{}) {
+				fkey := folder + "/" + key
+				if decided[fkey] {
+					continue
+				}
+				decided[fkey] = true
+				if src == nil {
 					continue
 				}
-				<-done
+				if sresources, ok := (*src)[folder]; ok {
+					if res, ok := sresources.(map[string]interface{})[key]; ok {
+						dst[folder].(map[string]interface{})[key] = res
+					}
+				}
+			}
+		}
+	}
+}
+
+// deploy does the request on the BIG-IP once, unless the circuit breaker is
+// open. The failed request is retried by settle.
+func (w *deployWorker) deploy(r DeployRequest) error {
+	slog := utils.LogFromContext(r.Context)
+	bc := &f5_bigip.BIGIPContext{BIGIP: *w.bigip, Context: r.Context}
+
+	if !w.breaker.allow() {
+		return fmt.Errorf("circuit breaker is open after %d failures, skipped", w.breaker.failures)
+	}
+	err := deployToBIGIP(bc, r)
+	if err == nil {
+		w.breaker.succeed()
+		return nil
+	}
+	slog.Errorf("failed to do deployment to %s: %s", bc.URL, err.Error())
+	if w.breaker.fail() {
+		slog.Errorf("circuit breaker of %s is open for %s", bc.URL, BreakerCooldown.String())
+	}
+	return err
+}
+
+// allow tells whether a deployment can be done. Once the cooldown is over, the
+// deployments are let through to probe the BIG-IP, and the first failure opens it again.
+func (b *circuitBreaker) allow() bool {
+	return b.failures < BreakerThreshold || time.Since(b.openedAt) >= BreakerCooldown
+}
+
+func (b *circuitBreaker) succeed() {
+	b.failures = 0
+}
+
+// fail records a failure and returns true if the breaker is opened by it.
+func (b *circuitBreaker) fail() bool {
+	b.failures++
+	if b.failures >= BreakerThreshold {
+		b.openedAt = time.Now()
+		return true
+	}
+	return false
+}
+
+// done collects the result of an attempt on the BIG-IP. The StatusFunc is
+// called once all the BIG-IPs have their first results, and again when the
+// failed ones recover or are given up.
+func (c *deployCollector) done(url string, err error, first, final bool) {
+	c.mutex.Lock()
+	if first {
+		c.pending--
+	}
+	_, wasFailed := c.failed[url]
+	if err != nil {
+		c.failed[url] = err
+	} else {
+		delete(c.failed, url)
+	}
+
+	report := false
+	switch {
+	case first:
+		report = c.pending == 0
+	case err == nil:
+		report = c.pending == 0 && wasFailed && len(c.failed) == 0
+	case final:
+		report = c.pending == 0
+	}
+	var derr *DeployError
+	if len(c.failed) > 0 {
+		derr = &DeployError{Errors: map[string]error{}, Retries: []DeployRequest{}}
+		for u, e := range c.failed {
+			derr.Errors[u] = e
+		}
+		// the given up request is left to the object to requeue, it's
+		// recomputed when sent again since the cache may have changed.
+		if final {
+			retry := c.request
+			retry.Context = context.WithValue(c.request.Context, CtxKey_SpecifiedBIGIP, url)
+			retry.Context = context.WithValue(retry.Context, CtxKey_GivenUpRequest, "yes")
+			derr.Retries = append(derr.Retries, retry)
+		}
+	}
+	c.mutex.Unlock()
+
+	if !report {
+		return
+	}
+	if derr != nil {
+		reportStatus(c.request.StatusFunc, derr)
+	} else {
+		reportStatus(c.request.StatusFunc, nil)
+	}
+}
+
+// reportStatus queues the call of the StatusFunc with err.
+func reportStatus(statusFunc func(error), err error) {
+	if statusFunc == nil {
+		return
+	}
+	statusReports.enqueue(func() { statusFunc(err) })
+}
+
+// enqueue never blocks, the reports are called in order.
+func (q *statusQueue) enqueue(report func()) {
+	q.mutex.Lock()
+	q.reports = append(q.reports, report)
+	q.mutex.Unlock()
+
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (q *statusQueue) run(stopCh chan struct{}) {
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-q.signal:
+		}
+		for {
+			q.mutex.Lock()
+			if len(q.reports) == 0 {
+				q.mutex.Unlock()
+				break
 			}
+			report := q.reports[0]
+			q.reports = q.reports[1:]
+			q.mutex.Unlock()
+
+			report()
 		}
 	}
 }
 
+func deployToBIGIP(bc *f5_bigip.BIGIPContext, r DeployRequest) error {
+	if r.Context.Value(CtxKey_CreatePartition) != nil {
+		partitions, err := partitionsOn(bc)
+		if err != nil {
+			return fmt.Errorf("failed to list partitions: %s", err.Error())
+		}
+		// only the partitions created by the controller are marked as owned,
+		// the existing ones may be shared with others.
+		if _, ok := partitions[r.Partition]; !ok {
+			if err := bc.DeployPartition(r.Partition); err != nil {
+				return fmt.Errorf("failed to deploy partition %s: %s", r.Partition, err.Error())
+			}
+			body := map[string]interface{}{"description": ownedPartitionDescription()}
+			if err := bc.Update("auth/partition", r.Partition, "", "", body); err != nil {
+				return fmt.Errorf("failed to mark partition %s: %s", r.Partition, err.Error())
+			}
+		}
+	}
+	if err := deploy(bc, r.Partition, r.From, r.To); err != nil {
+		return err
+	}
+	if r.Context.Value(CtxKey_DeletePartition) != nil {
+		if err := bc.DeletePartition(r.Partition); err != nil {
+			return fmt.Errorf("failed to delete partition %s: %s", r.Partition, err.Error())
+		}
+	}
+	return nil
+}
+
+func (e *DeployError) Error() string {
+	msgs := []string{}
+	for url, err := range e.Errors {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", url, err.Error()))
+	}
+	sort.Strings(msgs)
+	return strings.Join(msgs, "; ")
+}
+
 func EnableBGPRouting(bc *f5_bigip.BIGIPContext) error {
 	kind := "net/route-domain"
 	partition, subfolder, name := "Common", "", "0" // route domain 0
@@ -0,0 +1,100 @@
+package pkg
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestMergeRequests(t *testing.T) {
+	pool := func(desc string) map[string]interface{} {
+		return map[string]interface{}{"name": "ns.svc", "description": desc}
+	}
+	cfgs := func(resources map[string]interface{}) *map[string]interface{} {
+		return &map[string]interface{}{"": resources}
+	}
+	request := func(from, to map[string]interface{}) DeployRequest {
+		return DeployRequest{Meta: "test", From: cfgs(from), To: cfgs(to), Partition: "p", Context: context.TODO()}
+	}
+
+	cases := []struct {
+		name     string
+		requests []DeployRequest
+		from     *map[string]interface{}
+		to       *map[string]interface{}
+	}{
+		{
+			name: "create then delete",
+			requests: []DeployRequest{
+				request(map[string]interface{}{}, map[string]interface{}{"ltm/pool/ns.svc": pool("v1")}),
+				request(map[string]interface{}{"ltm/pool/ns.svc": pool("v1")}, map[string]interface{}{}),
+			},
+			from: cfgs(map[string]interface{}{}),
+			to:   cfgs(map[string]interface{}{}),
+		},
+		{
+			name: "delete then create",
+			requests: []DeployRequest{
+				request(map[string]interface{}{"ltm/pool/ns.svc": pool("v0")}, map[string]interface{}{}),
+				request(map[string]interface{}{}, map[string]interface{}{"ltm/pool/ns.svc": pool("v2")}),
+			},
+			from: cfgs(map[string]interface{}{"ltm/pool/ns.svc": pool("v0")}),
+			to:   cfgs(map[string]interface{}{"ltm/pool/ns.svc": pool("v2")}),
+		},
+		{
+			name: "update chain",
+			requests: []DeployRequest{
+				request(map[string]interface{}{"ltm/pool/ns.svc": pool("v0")}, map[string]interface{}{"ltm/pool/ns.svc": pool("v1")}),
+				request(map[string]interface{}{"ltm/pool/ns.svc": pool("v1")}, map[string]interface{}{
+					"ltm/pool/ns.svc":   pool("v2"),
+					"ltm/pool/ns.other": pool("v2"),
+				}),
+				request(map[string]interface{}{"ltm/pool/ns.svc": pool("v2")}, map[string]interface{}{"ltm/pool/ns.svc": pool("v3")}),
+			},
+			from: cfgs(map[string]interface{}{"ltm/pool/ns.svc": pool("v0")}),
+			to: cfgs(map[string]interface{}{
+				"ltm/pool/ns.svc":   pool("v3"),
+				"ltm/pool/ns.other": pool("v2"),
+			}),
+		},
+		{
+			name: "single request",
+			requests: []DeployRequest{
+				request(map[string]interface{}{"ltm/pool/ns.svc": pool("v0")}, map[string]interface{}{"ltm/pool/ns.svc": pool("v1")}),
+			},
+			from: cfgs(map[string]interface{}{"ltm/pool/ns.svc": pool("v0")}),
+			to:   cfgs(map[string]interface{}{"ltm/pool/ns.svc": pool("v1")}),
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			jobs := []*deployJob{}
+			for _, r := range c.requests {
+				jobs = append(jobs, &deployJob{request: r})
+			}
+			merged := mergeRequests(jobs)
+			if !reflect.DeepEqual(merged.From, c.from) {
+				t.Errorf("From: expected %v, got %v", *c.from, *merged.From)
+			}
+			if !reflect.DeepEqual(merged.To, c.to) {
+				t.Errorf("To: expected %v, got %v", *c.to, *merged.To)
+			}
+			if merged.Partition != "p" {
+				t.Errorf("Partition: expected p, got %s", merged.Partition)
+			}
+		})
+	}
+}
+
+func TestMergeRequestsCreatePartition(t *testing.T) {
+	empty := &map[string]interface{}{"": map[string]interface{}{}}
+	jobs := []*deployJob{
+		{request: DeployRequest{From: empty, To: empty, Partition: "p", Context: context.TODO()}},
+		{request: DeployRequest{From: empty, To: empty, Partition: "p",
+			Context: context.WithValue(context.TODO(), CtxKey_CreatePartition, "yes")}},
+	}
+	if merged := mergeRequests(jobs); merged.Context.Value(CtxKey_CreatePartition) == nil {
+		t.Errorf("the partition to create is lost in the merged request")
+	}
+}
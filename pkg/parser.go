@@ -1,21 +1,33 @@
 package pkg
 
 import (
+	"crypto/sha256"
 	"fmt"
+	"net"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 
 	"gitee.com/zongzw/bigip-kubernetes-gateway/k8s"
 	"gitee.com/zongzw/f5-bigip-rest/utils"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
 	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
 )
 
 func ParseGatewayRelatedForClass(className string, gwObjs []*gatewayv1beta1.Gateway) (map[string]interface{}, error) {
 	defer utils.TimeItToPrometheus()()
 
-	if ActiveSIGs.GetGatewayClass(className) == nil {
+	gwc := ActiveSIGs.GetGatewayClass(className)
+	if gwc == nil {
 		return map[string]interface{}{}, nil
 	}
+	// nothing of the class is deployed with invalid parameters.
+	if _, err := ActiveSIGs.ClassParametersOf(gwc); err != nil {
+		return map[string]interface{}{}, err
+	}
 
 	cgwObjs := []*gatewayv1beta1.Gateway{}
 	for _, gw := range gwObjs {
@@ -24,23 +36,25 @@ func ParseGatewayRelatedForClass(className string, gwObjs []*gatewayv1beta1.Gate
 		}
 	}
 
+	// The invalid gateways and routes are skipped rather than failing the
+	// whole class, their errors are reported in their status.
 	rlt := map[string]interface{}{}
 	for _, gw := range cgwObjs {
-		if cfgs, err := parseGateway(gw); err != nil {
-			return map[string]interface{}{}, err
+		// the invalid listeners are skipped by parseGateway.
+		if cfgs, _, err := parseGateway(gw); err != nil {
+			continue
 		} else {
 			for k, v := range cfgs {
 				rlt[k] = v
 			}
 		}
-		hrs := ActiveSIGs.AttachedHTTPRoutes(gw)
-		for _, hr := range hrs {
-			if cfgs, err := parseHTTPRoute(className, hr); err != nil {
-				return map[string]interface{}{}, err
-			} else {
-				for k, v := range cfgs {
-					rlt[k] = v
-				}
+		// the rules of the tlsroutes are referred by the virtuals of the TLS listeners.
+		trs := ActiveSIGs.AttachedTLSRoutes(gw)
+		for _, tr := range trs {
+			// the invalid backends are skipped, the same as the httproutes.
+			cfgs, _ := parseTLSRoute(className, tr)
+			for k, v := range cfgs {
+				rlt[k] = v
 			}
 		}
 	}
@@ -49,16 +63,49 @@ func ParseGatewayRelatedForClass(className string, gwObjs []*gatewayv1beta1.Gate
 	}, nil
 }
 
-// ParseServicesRelatedForAll parse all refered services
-func ParseServicesRelatedForAll() (map[string]interface{}, error) {
+// ParseServicesRelatedForAll parse all refered services, keyed by the backend partitions.
+func ParseServicesRelatedForAll() (map[string]map[string]interface{}, error) {
 
 	// all services that are referenced but may not exist
-	svcs := ActiveSIGs.AllAttachedServiceKeys()
+	partitions := ActiveSIGs.AttachedServiceKeysByBackendPartition()
+
+	rlt := map[string]map[string]interface{}{}
+	for partition, svcs := range partitions {
+		if cfgs, err := parseServiceKeysIn(partition, svcs); err != nil {
+			return rlt, err
+		} else {
+			rlt[partition] = cfgs
+		}
+	}
+	return rlt, nil
+}
+
+// ParseReferedServiceKeys parses the given services in the backend partitions
+// referring them, keyed by the backend partitions.
+func ParseReferedServiceKeys(svcs []string) (map[string]map[string]interface{}, error) {
+	partitions := ActiveSIGs.AttachedServiceKeysByBackendPartition()
 
-	return ParseReferedServiceKeys(svcs)
+	rlt := map[string]map[string]interface{}{}
+	for partition, keys := range partitions {
+		referred := []string{}
+		for _, svc := range svcs {
+			if contains(keys, svc) {
+				referred = append(referred, svc)
+			}
+		}
+		if len(referred) == 0 {
+			continue
+		}
+		if cfgs, err := parseServiceKeysIn(partition, referred); err != nil {
+			return rlt, err
+		} else {
+			rlt[partition] = cfgs
+		}
+	}
+	return rlt, nil
 }
 
-func ParseReferedServiceKeys(svcs []string) (map[string]interface{}, error) {
+func parseServiceKeysIn(partition string, svcs []string) (map[string]interface{}, error) {
 	rlt := map[string]interface{}{}
 	for _, svc := range svcs {
 
@@ -71,17 +118,32 @@ func ParseReferedServiceKeys(svcs []string) (map[string]interface{}, error) {
 			"monitor": "min 1 of tcp",
 			"members": []interface{}{},
 		}
+		// the invalid options are reported by the service controller, the defaults are used.
+		poolOpts, memberOpts := map[string]interface{}{}, map[string]interface{}{}
+		if s := ActiveSIGs.GetService(svc); s != nil {
+			if popts, mopts, err := PoolOptionsOfAnnotations(s.Annotations); err == nil {
+				poolOpts, memberOpts = popts, mopts
+			}
+		}
+		for k, v := range poolOpts {
+			rlt["ltm/pool/"+name].(map[string]interface{})[k] = v
+		}
 		if fmtmbs, err := parseMembersFrom(ns, n); err != nil {
 			return rlt, err
 		} else {
+			for _, mb := range fmtmbs {
+				for k, v := range memberOpts {
+					mb.(map[string]interface{})[k] = v
+				}
+			}
 			rlt["ltm/pool/"+name].(map[string]interface{})["members"] = fmtmbs
 		}
 
-		if mon, err := parseMonitorFrom(ns, n); err != nil {
-			return rlt, err
-		} else {
-			rlt["ltm/pool/"+name].(map[string]interface{})["monitor"] = mon
-		}
+		// the invalid monitor annotations are reported by the service controller.
+		mon, _ := parseMonitorFrom(partition, ns, n, rlt)
+		rlt["ltm/pool/"+name].(map[string]interface{})["monitor"] = mon
+		// the same as the monitor, the errors of backend TLS are reported by the service controller.
+		_ = parseServerSSLFrom(ActiveSIGs.GetService(svc), rlt)
 
 		if err := parseArpsFrom(ns, n, rlt); err != nil {
 			return rlt, err
@@ -105,295 +167,1019 @@ func parseHTTPRoute(className string, hr *gatewayv1beta1.HTTPRoute) (map[string]
 
 	rlt := map[string]interface{}{}
 
-	if err := parseiRulesFrom(className, hr, rlt); err != nil {
-		return map[string]interface{}{}, err
+	// the httproute is deployed into the listeners' policies or dispatch
+	// rules by parseGateway, only the invalid rules are checked here.
+	_, err := parseiRuleActionsFrom(ActiveSIGs.BackendPartitionOfClass(className), hr)
+	if _, _, lerr := requestLoggingOf(hr.Annotations); lerr != nil {
+		if err == nil {
+			return rlt, lerr
+		}
+		return rlt, fmt.Errorf("%s; %s", err.Error(), lerr.Error())
 	}
 
-	return rlt, nil
+	return rlt, err
 }
 
-func parseGateway(gw *gatewayv1beta1.Gateway) (map[string]interface{}, error) {
+func parseTLSRoute(className string, tr *gatewayv1alpha2.TLSRoute) (map[string]interface{}, error) {
 	defer utils.TimeItToPrometheus()()
 
-	if gw == nil {
+	if tr == nil {
 		return map[string]interface{}{}, nil
 	}
 
+	rlt := map[string]interface{}{}
+
+	// the rule is kept even if some of the backends are skipped.
+	err := parseSNIRulesFrom(className, tr, rlt)
+
+	return rlt, err
+}
+
+// parseGateway returns the configs of gw. The listeners failing to parse are
+// skipped and returned as listenerErrs keyed by their names, the others are
+// still deployed. err fails the whole gateway.
+func parseGateway(gw *gatewayv1beta1.Gateway) (cfgs map[string]interface{}, listenerErrs map[string]error, err error) {
+	defer utils.TimeItToPrometheus()()
+
+	if gw == nil {
+		return map[string]interface{}{}, map[string]error{}, nil
+	}
+
 	rlt := map[string]interface{}{}
 	irules := map[string][]string{}
-	listeners := map[string]*gatewayv1beta1.Listener{}
 
-	for i, listener := range gw.Spec.Listeners {
-		vsname := gwListenerName(gw, &listener)
-		listeners[vsname] = &gw.Spec.Listeners[i]
-		if listener.Hostname != nil {
-			if _, ok := irules[vsname]; !ok {
-				irules[vsname] = []string{}
+	className := string(gw.Spec.GatewayClassName)
+	params, err := ActiveSIGs.ClassParametersOf(ActiveSIGs.GetGatewayClass(className))
+	if err != nil {
+		return map[string]interface{}{}, map[string]error{}, err
+	}
+	backendPartition := ActiveSIGs.BackendPartitionOfClass(className)
+	if params == nil {
+		params = &BIGIPGatewayClassParametersSpec{}
+	}
+	gwLogging, _, loggingErr := requestLoggingOf(gw.Annotations)
+	snat, snatErr := parseSNATFrom(gw, params, rlt)
+	vsProfiles := profilesOf(params)
+
+	listenerErrs = map[string]error{}
+	sslProfiles := map[string]string{}
+	for i := range gw.Spec.Listeners {
+		listener := &gw.Spec.Listeners[i]
+		var lerr error
+		switch listener.Protocol {
+		case gatewayv1beta1.HTTPProtocolType:
+			lerr = loggingErr
+		case gatewayv1beta1.HTTPSProtocolType:
+			lerr = loggingErr
+			if lerr == nil {
+				// the files of the certificates are kept only if the listener is valid.
+				ssl := map[string]interface{}{}
+				if sslProfiles[string(listener.Name)], lerr = parseClientSSLFrom(gw, listener, vsProfiles.ClientSSL, ssl); lerr == nil {
+					for k, v := range ssl {
+						rlt[k] = v
+					}
+				}
 			}
+		case gatewayv1beta1.TLSProtocolType:
+			if listener.TLS == nil || listener.TLS.Mode == nil || *listener.TLS.Mode != gatewayv1beta1.TLSModePassthrough {
+				lerr = fmt.Errorf("only Passthrough mode is supported for TLS listener %s", listener.Name)
+			}
+		case gatewayv1beta1.TCPProtocolType, gatewayv1beta1.UDPProtocolType:
+		default:
+			lerr = fmt.Errorf("unsupported ProtocolType: %s", listener.Protocol)
+		}
+		// the snat is shared by the virtuals of all the listeners.
+		if snatErr != nil {
+			lerr = snatErr
+		}
+		if lerr != nil {
+			listenerErrs[string(listener.Name)] = lerr
+		}
+	}
+
+	for _, listener := range gw.Spec.Listeners {
+		vsname := gwListenerName(gw, &listener)
+		if listenerErrs[string(listener.Name)] != nil {
+			continue
+		}
+		if listener.Protocol == gatewayv1beta1.TLSProtocolType {
+			// the listener's rule reads the sni before the tlsroutes' rules pick the pool.
 			irules[vsname] = append(irules[vsname], vsname)
-			rule := map[string]interface{}{
-				"name": vsname,
-				"apiAnonymous": fmt.Sprintf(`
-					when HTTP_REQUEST {
-						if { not ([HTTP::host] matches "%s") } {
-							event HTTP_REQUEST disable
-						}
-					}
-				`, *listener.Hostname),
+			rlt["ltm/rule/"+vsname] = map[string]interface{}{
+				"name":         vsname,
+				"apiAnonymous": sniListenerRule(listener.Hostname),
 			}
-			rlt["ltm/rule/"+vsname] = rule
 		}
 	}
 
 	hrs := ActiveSIGs.AttachedHTTPRoutes(gw)
+	listenerRoutes := map[string][]*gatewayv1beta1.HTTPRoute{}
+	routed := map[string][]string{}
 	for _, hr := range hrs {
+		routetype := hrKind(hr)
 		for _, pr := range hr.Spec.ParentRefs {
-			ns := hr.Namespace
-			if pr.Namespace != nil {
-				ns = string(*pr.Namespace)
+			for _, listener := range parentListeners(gw, hr.Namespace, &pr) {
+				vsname := gwListenerName(gw, listener)
+				if listenerErrs[string(listener.Name)] != nil ||
+					!routeMatches(gw.Namespace, listener, ActiveSIGs.GetNamespace(hr.Namespace), routetype) {
+					continue
+				}
+				if !contains(routed[vsname], hrName(hr)) {
+					routed[vsname] = append(routed[vsname], hrName(hr))
+					listenerRoutes[vsname] = append(listenerRoutes[vsname], hr)
+				}
+			}
+		}
+	}
+	// the routes of a listener are deployed together, in the order of the match
+	// precedence, either as the rules of its ltm policy or as one dispatch iRule.
+	policyRules := map[string][]interface{}{}
+	serverSSLs := map[string]bool{}
+	grpcListeners := map[string]bool{}
+	for _, listener := range gw.Spec.Listeners {
+		vsname := gwListenerName(gw, &listener)
+		lhrs, ok := listenerRoutes[vsname]
+		if !ok {
+			continue
+		}
+		// the requests are logged by the iRule only.
+		inPolicy := true
+		for _, hr := range lhrs {
+			inPolicy = inPolicy && policyExpressible(hr) && routeLogging(gwLogging, hr) == nil
+			grpcListeners[vsname] = grpcListeners[vsname] || hrKind(hr) == grpcRouteKind
+		}
+		branches := httpBranchesOf(lhrs)
+		if inPolicy {
+			rules := []interface{}{}
+			for _, b := range branches {
+				rules = append(rules, parsePolicyRulesFrom(b, &listener, backendPartition)...)
+			}
+			for i := range rules {
+				rules[i].(map[string]interface{})["ordinal"] = i
 			}
-			if pr.SectionName == nil {
-				return map[string]interface{}{}, fmt.Errorf("sectionName of paraentRefs is nil, not supported")
+			policyRules[vsname] = rules
+			rlt["ltm/policy/"+vsname] = map[string]interface{}{
+				"name":     vsname,
+				"legacy":   true,
+				"strategy": "/Common/first-match",
+				"requires": []string{"http"},
+				"controls": []string{"forwarding"},
+				"rules":    rules,
 			}
-			vsname := hrParentName(hr, &pr)
-			if _, ok := irules[vsname]; !ok {
-				irules[vsname] = []string{}
+		} else {
+			irules[vsname] = []string{vsname}
+			rlt["ltm/rule/"+vsname] = parseDispatchRuleFrom(vsname, backendPartition, &listener, branches, gwLogging)
+		}
+
+		tlsKeys := []string{}
+		for _, hr := range lhrs {
+			for _, svc := range ActiveSIGs.AttachedServices(hr) {
+				key := utils.Keyname(svc.Namespace, svc.Name)
+				if BackendTLSEnabled(svc) && !contains(tlsKeys, key) {
+					tlsKeys = append(tlsKeys, key)
+				}
 			}
-			routetype := reflect.TypeOf(*hr).Name()
-			if routeMatches(ns, listeners[vsname], ActiveSIGs.GetNamespace(hr.Namespace), routetype) {
-				irules[vsname] = append(irules[vsname], hrName(hr))
+		}
+		if len(tlsKeys) > 0 {
+			sort.Strings(tlsKeys)
+			rulename := vsname + ".serverssl"
+			irules[vsname] = append(irules[vsname], rulename)
+			rlt["ltm/rule/"+rulename] = map[string]interface{}{
+				"name":         rulename,
+				"apiAnonymous": serverSSLRule(backendPartition, tlsKeys),
+			}
+			serverSSLs[vsname] = true
+		}
+	}
+	trs := ActiveSIGs.AttachedTLSRoutes(gw)
+	for _, tr := range trs {
+		routetype := reflect.TypeOf(*tr).Name()
+		for _, pr := range tr.Spec.ParentRefs {
+			bpr := betaParentRef(pr)
+			for _, listener := range parentListeners(gw, tr.Namespace, &bpr) {
+				vsname := gwListenerName(gw, listener)
+				if listenerErrs[string(listener.Name)] != nil {
+					continue
+				}
+				if _, ok := irules[vsname]; !ok {
+					irules[vsname] = []string{}
+				}
+				if routeMatches(gw.Namespace, listener, ActiveSIGs.GetNamespace(tr.Namespace), routetype) &&
+					!contains(irules[vsname], trName(tr)) {
+					irules[vsname] = append(irules[vsname], trName(tr))
+				}
 			}
 		}
 	}
+	pools := parseL4PoolsFrom(gw, backendPartition)
+
 	for _, addr := range gw.Spec.Addresses {
 		if *addr.Type == gatewayv1beta1.IPAddressType {
 			ipaddr := addr.Value
+			if params.RouteDomain != nil {
+				ipaddr = fmt.Sprintf("%s%%%d", ipaddr, *params.RouteDomain)
+			}
 			for _, listener := range gw.Spec.Listeners {
+				if listenerErrs[string(listener.Name)] != nil {
+					continue
+				}
 				var profiles []interface{}
 				ipProtocol := ""
 				switch listener.Protocol {
 				case gatewayv1beta1.HTTPProtocolType:
-					profiles = []interface{}{map[string]string{"name": "http"}}
+					profiles = []interface{}{map[string]string{"name": vsProfiles.HTTP}}
+					ipProtocol = "tcp"
+				case gatewayv1beta1.HTTPSProtocolType:
+					profiles = []interface{}{
+						map[string]string{"name": vsProfiles.HTTP},
+						map[string]string{"name": sslProfiles[string(listener.Name)], "context": "clientside"},
+					}
 					ipProtocol = "tcp"
 				case gatewayv1beta1.TCPProtocolType:
-					return map[string]interface{}{}, fmt.Errorf("unsupported ProtocolType: %s", listener.Protocol)
+					profiles = []interface{}{map[string]string{"name": vsProfiles.FastL4}}
+					ipProtocol = "tcp"
 				case gatewayv1beta1.UDPProtocolType:
-					return map[string]interface{}{}, fmt.Errorf("unsupported ProtocolType: %s", listener.Protocol)
+					profiles = []interface{}{map[string]string{"name": vsProfiles.UDP}}
+					ipProtocol = "udp"
 				case gatewayv1beta1.TLSProtocolType:
-					return map[string]interface{}{}, fmt.Errorf("unsupported ProtocolType: %s", listener.Protocol)
-				}
-				if ipProtocol == "" {
-					return map[string]interface{}{}, fmt.Errorf("ipProtocol not set in %s case", listener.Protocol)
+					profiles = []interface{}{map[string]string{"name": vsProfiles.TCP}}
+					ipProtocol = "tcp"
 				}
 				destination := fmt.Sprintf("%s:%d", ipaddr, listener.Port)
-				if utils.IsIpv6(ipaddr) {
+				if utils.IsIpv6(addr.Value) {
 					destination = fmt.Sprintf("%s.%d", ipaddr, listener.Port)
 				}
 				name := gwListenerName(gw, &listener)
 
 				rlt["ltm/virtual/"+name] = map[string]interface{}{
-					"name":        name,
-					"profiles":    profiles,
-					"ipProtocol":  ipProtocol,
-					"destination": destination,
-					"sourceAddressTranslation": map[string]interface{}{
-						"type": "automap",
-					},
-					"rules": []interface{}{},
+					"name":                     name,
+					"profiles":                 profiles,
+					"ipProtocol":               ipProtocol,
+					"destination":              destination,
+					"sourceAddressTranslation": snat,
+					"rules":                    []interface{}{},
 				}
 				if _, ok := irules[name]; ok {
 					rlt["ltm/virtual/"+name].(map[string]interface{})["rules"] = irules[name]
 				}
+				if len(params.VLANs) > 0 {
+					rlt["ltm/virtual/"+name].(map[string]interface{})["vlansEnabled"] = true
+					rlt["ltm/virtual/"+name].(map[string]interface{})["vlans"] = params.VLANs
+				}
+				if grpcListeners[name] {
+					profiles = append(profiles,
+						map[string]string{"name": vsProfiles.HTTP2, "context": "all"},
+						map[string]string{"name": vsProfiles.HTTPRouter},
+					)
+					rlt["ltm/virtual/"+name].(map[string]interface{})["profiles"] = profiles
+				}
+				if serverSSLs[name] {
+					profiles = append(profiles, map[string]string{"name": vsProfiles.ServerSSL, "context": "serverside"})
+					rlt["ltm/virtual/"+name].(map[string]interface{})["profiles"] = profiles
+				}
+				if listener.Protocol == gatewayv1beta1.HTTPProtocolType || listener.Protocol == gatewayv1beta1.HTTPSProtocolType {
+					policies := []interface{}{}
+					if _, ok := policyRules[name]; ok {
+						policies = append(policies, map[string]string{"name": name})
+					}
+					rlt["ltm/virtual/"+name].(map[string]interface{})["policies"] = policies
+					rlt["ltm/virtual/"+name].(map[string]interface{})["persist"] = persistProfilesOf(listenerRoutes[name])
+				}
+				if listener.Protocol == gatewayv1beta1.TCPProtocolType || listener.Protocol == gatewayv1beta1.UDPProtocolType {
+					pool := "none"
+					if p, ok := pools[name]; ok {
+						pool = p
+					}
+					rlt["ltm/virtual/"+name].(map[string]interface{})["pool"] = pool
+				}
 			}
 		} else {
-			return map[string]interface{}{}, fmt.Errorf("unsupported AddressType: %s", *addr.Type)
+			return map[string]interface{}{}, map[string]error{}, fmt.Errorf("unsupported AddressType: %s", *addr.Type)
 		}
 	}
 
-	return rlt, nil
-}
-
-// TODO: find the way to set monitor
-func parseMonitorFrom(svcNamespace, svcName string) (string, error) {
-	return "min 1 of tcp", nil
+	return rlt, listenerErrs, nil
 }
 
-func parseMembersFrom(svcNamespace, svcName string) ([]interface{}, error) {
-	svc := ActiveSIGs.GetService(utils.Keyname(svcNamespace, svcName))
-	eps := ActiveSIGs.GetEndpoints(utils.Keyname(svcNamespace, svcName))
-	if svc != nil && eps != nil {
-		if mbs, err := k8s.FormatMembersFromServiceEndpoints(svc, eps); err != nil {
-			return []interface{}{}, err
-		} else {
-			fmtmbs := []interface{}{}
+// parseSNATFrom returns the source address translation of the virtuals of gw,
+// the snatpool is created if the addresses are given. Without the annotation,
+// the snat of the class parameters is used.
+func parseSNATFrom(gw *gatewayv1beta1.Gateway, params *BIGIPGatewayClassParametersSpec, rlt map[string]interface{}) (map[string]interface{}, error) {
+	mode, ok := gw.Annotations[AnnotationSNAT]
+	addresses := []string{}
+	for _, addr := range strings.Split(gw.Annotations[AnnotationSNATAddresses], ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addresses = append(addresses, addr)
+		}
+	}
+	if !ok {
+		mode = "automap"
+		if params.SNAT != nil && len(addresses) == 0 {
+			mode, addresses = params.SNAT.Mode, params.SNAT.Addresses
+		}
+	}
 
-			for _, mb := range mbs {
-				sep := ":"
-				if utils.IsIpv6(mb.IpAddr) {
-					sep = "."
-				}
-				fmtmbs = append(fmtmbs, map[string]interface{}{
-					"name":    fmt.Sprintf("%s%s%d", mb.IpAddr, sep, mb.TargetPort),
-					"address": mb.IpAddr,
-				})
+	switch mode {
+	case "automap", "none":
+		if len(addresses) > 0 {
+			return nil, fmt.Errorf("%s is only for snatpool", AnnotationSNATAddresses)
+		}
+		return map[string]interface{}{"type": mode}, nil
+	case "snatpool":
+		if len(addresses) == 0 {
+			return nil, fmt.Errorf("%s must be set for snatpool", AnnotationSNATAddresses)
+		}
+		members := []string{}
+		for _, addr := range addresses {
+			if err := snatAddressValid(addr); err != nil {
+				return nil, err
 			}
-			return fmtmbs, nil
+			if params.RouteDomain != nil {
+				addr = fmt.Sprintf("%s%%%d", addr, *params.RouteDomain)
+			}
+			members = append(members, addr)
 		}
-	} else {
-		return []interface{}{}, nil
+		name := strings.Join([]string{"gw", gw.Namespace, gw.Name}, ".")
+		rlt["ltm/snatpool/"+name] = map[string]interface{}{
+			"name":    name,
+			"members": members,
+		}
+		return map[string]interface{}{"type": "snat", "pool": name}, nil
+	default:
+		return nil, fmt.Errorf("invalid %s: '%s', must be automap, snatpool or none", AnnotationSNAT, mode)
 	}
 }
 
-func parseArpsFrom(svcNamespace, svcName string, rlt map[string]interface{}) error {
-	svc := ActiveSIGs.GetService(utils.Keyname(svcNamespace, svcName))
-	eps := ActiveSIGs.GetEndpoints(utils.Keyname(svcNamespace, svcName))
-	if svc != nil && eps != nil {
-		if mbs, err := k8s.FormatMembersFromServiceEndpoints(svc, eps); err != nil {
-			return err
-		} else {
-			prefix := "k8s-"
-			for _, mb := range mbs {
-				if mb.MacAddr != "" {
-					rlt["net/arp/"+prefix+mb.IpAddr] = map[string]interface{}{
-						"name":       prefix + mb.IpAddr,
-						"ipAddress":  mb.IpAddr,
-						"macAddress": mb.MacAddr,
-					}
-				}
+// profilesOf returns the profiles of the virtuals, with the ones of the class parameters overriding the defaults.
+func profilesOf(params *BIGIPGatewayClassParametersSpec) BIGIPGatewayClassProfiles {
+	profiles := BIGIPGatewayClassProfiles{
+		HTTP:      "http",
+		TCP:       "tcp",
+		FastL4:    "fastL4",
+		UDP:       "udp",
+		ClientSSL: "/Common/clientssl",
+		ServerSSL: "/Common/serverssl",
+		// the grpc requests are proxied with http/2 on both sides.
+		HTTP2:      "/Common/http2",
+		HTTPRouter: "/Common/httprouter",
+	}
+	if params.Profiles == nil {
+		return profiles
+	}
+	if params.Profiles.HTTP != "" {
+		profiles.HTTP = params.Profiles.HTTP
+	}
+	if params.Profiles.TCP != "" {
+		profiles.TCP = params.Profiles.TCP
+	}
+	if params.Profiles.FastL4 != "" {
+		profiles.FastL4 = params.Profiles.FastL4
+	}
+	if params.Profiles.UDP != "" {
+		profiles.UDP = params.Profiles.UDP
+	}
+	if params.Profiles.ClientSSL != "" {
+		profiles.ClientSSL = params.Profiles.ClientSSL
+	}
+	if params.Profiles.ServerSSL != "" {
+		profiles.ServerSSL = params.Profiles.ServerSSL
+	}
+	if params.Profiles.HTTP2 != "" {
+		profiles.HTTP2 = params.Profiles.HTTP2
+	}
+	if params.Profiles.HTTPRouter != "" {
+		profiles.HTTPRouter = params.Profiles.HTTPRouter
+	}
+	return profiles
+}
+
+// snatAddressValid checks that addr is in the subnet of a selfIP of every
+// BIG-IP and is not the selfIP itself. The BIG-IPs without selfIPs in the
+// config are not checked.
+func snatAddressValid(addr string) error {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return fmt.Errorf("invalid snat address '%s'", addr)
+	}
+	for _, bc := range BIPConfigs {
+		if bc.Flannel == nil || len(bc.Flannel.SelfIPs) == 0 {
+			continue
+		}
+		found := false
+		for _, selfip := range bc.Flannel.SelfIPs {
+			selfaddr, ipnet, err := net.ParseCIDR(selfip.IpMask)
+			if err != nil {
+				continue
 			}
+			if selfaddr.Equal(ip) {
+				return fmt.Errorf("snat address '%s' is the selfIP %s", addr, selfip.Name)
+			}
+			found = found || ipnet.Contains(ip)
+		}
+		if !found {
+			return fmt.Errorf("snat address '%s' is not in the subnets of the selfIPs", addr)
 		}
 	}
 	return nil
 }
 
-func parseNodesFrom(svcNamespace, svcName string, rlt map[string]interface{}) error {
-	svc := ActiveSIGs.GetService(utils.Keyname(svcNamespace, svcName))
-	eps := ActiveSIGs.GetEndpoints(utils.Keyname(svcNamespace, svcName))
-	if svc != nil && eps != nil {
-		if mbs, err := k8s.FormatMembersFromServiceEndpoints(svc, eps); err != nil {
-			return err
-		} else {
-			for _, mb := range mbs {
-				if mb.MacAddr != "" {
-					rlt["ltm/node/"+mb.IpAddr] = map[string]interface{}{
-						"name":    mb.IpAddr,
-						"address": mb.IpAddr,
-						"monitor": "default",
-						"session": "user-enabled",
-					}
-				}
-			}
+// parseClientSSLFrom uploads the certificates of the HTTPS listener and
+// creates the client-ssl profile with them, the profile name is returned.
+func parseClientSSLFrom(gw *gatewayv1beta1.Gateway, listener *gatewayv1beta1.Listener, defaultsFrom string, rlt map[string]interface{}) (string, error) {
+	if listener.TLS == nil {
+		return "", fmt.Errorf("tls of listener %s must be set for HTTPS", listener.Name)
+	}
+	if listener.TLS.Mode != nil && *listener.TLS.Mode != gatewayv1beta1.TLSModeTerminate {
+		return "", fmt.Errorf("unsupported TLSModeType for HTTPS: %s", *listener.TLS.Mode)
+	}
+	if len(listener.TLS.CertificateRefs) == 0 {
+		return "", fmt.Errorf("certificateRefs of listener %s must be set for HTTPS", listener.Name)
+	}
+
+	certKeyChain := []interface{}{}
+	for _, ref := range listener.TLS.CertificateRefs {
+		if (ref.Group != nil && *ref.Group != "") || (ref.Kind != nil && *ref.Kind != "Secret") {
+			return "", fmt.Errorf("unsupported certificateRef %s, only v1.Secret", ref.Name)
+		}
+		ns := gw.Namespace
+		if ref.Namespace != nil {
+			ns = string(*ref.Namespace)
+		}
+		if !ActiveSIGs.ReferenceGranted(reflect.TypeOf(*gw).Name(), gw.Namespace, "Secret", utils.Keyname(ns, string(ref.Name))) {
+			return "", fmt.Errorf("secret %s is not permitted", utils.Keyname(ns, string(ref.Name)))
+		}
+		scrt := ActiveSIGs.GetSecret(utils.Keyname(ns, string(ref.Name)))
+		if scrt == nil {
+			return "", fmt.Errorf("secret %s not found", utils.Keyname(ns, string(ref.Name)))
+		}
+		if len(scrt.Data[v1.TLSCertKey]) == 0 || len(scrt.Data[v1.TLSPrivateKeyKey]) == 0 {
+			return "", fmt.Errorf("secret %s has no %s or %s", utils.Keyname(ns, string(ref.Name)), v1.TLSCertKey, v1.TLSPrivateKeyKey)
+		}
+
+		name := secretName(scrt)
+		crtfile, keyfile := name+".crt", name+".key"
+		rlt["shared/file-transfer/uploads/"+crtfile] = map[string]interface{}{
+			"content": string(scrt.Data[v1.TLSCertKey]),
+		}
+		rlt["shared/file-transfer/uploads/"+keyfile] = map[string]interface{}{
+			"content": string(scrt.Data[v1.TLSPrivateKeyKey]),
+		}
+		rlt["sys/file/ssl-cert/"+crtfile] = map[string]interface{}{
+			"name":       crtfile,
+			"sourcePath": "file:/var/config/rest/downloads/" + crtfile,
+		}
+		rlt["sys/file/ssl-key/"+keyfile] = map[string]interface{}{
+			"name":       keyfile,
+			"sourcePath": "file:/var/config/rest/downloads/" + keyfile,
 		}
+		certKeyChain = append(certKeyChain, map[string]interface{}{
+			"name": name,
+			"cert": crtfile,
+			"key":  keyfile,
+		})
 	}
-	return nil
+
+	name := gwListenerName(gw, listener)
+	rlt["ltm/profile/client-ssl/"+name] = map[string]interface{}{
+		"name":         name,
+		"defaultsFrom": defaultsFrom,
+		"certKeyChain": certKeyChain,
+	}
+	return name, nil
 }
 
-func parseiRulesFrom(className string, hr *gatewayv1beta1.HTTPRoute, rlt map[string]interface{}) error {
-	name := hrName(hr)
+// parseMonitorFrom creates the monitor of the service's pool, which is
+// configured by the annotations or follows the readiness probe of the pods.
+// The default tcp monitor is used if neither is usable.
+func parseMonitorFrom(partition, svcNamespace, svcName string, rlt map[string]interface{}) (string, error) {
+	defaultMonitor := "min 1 of tcp"
+	svc := ActiveSIGs.GetService(utils.Keyname(svcNamespace, svcName))
+	if svc == nil {
+		return defaultMonitor, nil
+	}
 
-	// hostnames
-	hostnameConditions := []string{}
-	for _, hn := range hr.Spec.Hostnames {
-		hostnameConditions = append(hostnameConditions, fmt.Sprintf(`[HTTP::host] matches "%s"`, hn))
+	var mtype string
+	var monitor map[string]interface{}
+	if _, ok := svc.Annotations[AnnotationMonitorType]; ok {
+		var err error
+		if mtype, monitor, err = MonitorOfAnnotations(svc.Annotations); err != nil {
+			return defaultMonitor, err
+		}
+	} else if probe := ActiveSIGs.GetReadinessProbe(utils.Keyname(svcNamespace, svcName)); probe != nil {
+		mtype, monitor = monitorOfProbe(probe)
 	}
-	hostnameCondition := strings.Join(hostnameConditions, " or ")
-	if hostnameCondition == "" {
-		hostnameCondition = "1 eq 1"
+	if monitor == nil {
+		return defaultMonitor, nil
 	}
 
-	rules := []string{}
-	ruleInits := []string{}
-	for i, rl := range hr.Spec.Rules {
-		ruleConditions := []string{}
-		filterActions := []string{}
-		poolWeights := []string{}
+	name := strings.Join([]string{svcNamespace, svcName}, ".")
+	monitor["name"] = name
+	rlt["ltm/monitor/"+mtype+"/"+name] = monitor
+	return fmt.Sprintf("/%s/%s", partition, name), nil
+}
 
-		// matches
-		for _, match := range rl.Matches {
-			matchConditions := []string{}
-			if match.Path != nil {
-				matchType := gatewayv1beta1.PathMatchPathPrefix
-				if match.Path.Type != nil {
-					matchType = *match.Path.Type
-				}
-				switch matchType {
-				case gatewayv1beta1.PathMatchPathPrefix:
-					matchConditions = append(matchConditions, fmt.Sprintf(`[HTTP::path] starts_with "%s"`, *match.Path.Value))
-				case gatewayv1beta1.PathMatchExact:
-					matchConditions = append(matchConditions, fmt.Sprintf(`[HTTP::path] eq "%s"`, *match.Path.Value))
-				case gatewayv1beta1.PathMatchRegularExpression:
-					matchConditions = append(matchConditions, fmt.Sprintf(`[HTTP::path matches "%s"`, *match.Path.Value))
-				}
-			}
-			if match.Headers != nil {
-				for _, header := range match.Headers {
-					matchType := gatewayv1beta1.HeaderMatchExact
-					if header.Type != nil {
-						matchType = *header.Type
-					}
-					switch matchType {
-					case gatewayv1beta1.HeaderMatchExact:
-						matchConditions = append(matchConditions, fmt.Sprintf(`[HTTP::header "%s"] eq "%s"`, header.Name, header.Value))
-					case gatewayv1beta1.HeaderMatchRegularExpression:
-						matchConditions = append(matchConditions, fmt.Sprintf(`[HTTP::header "%s"] matches "%s"`, header.Name, header.Value))
-					}
-				}
-			}
-			if match.Method != nil {
-				matchConditions = append(matchConditions, fmt.Sprintf(`[HTTP::method] eq "%s"`, *match.Method))
+// parseServerSSLFrom creates the server-ssl profile of the service's pool if
+// its backend TLS is enabled. The profile is still created with the certificates
+// that are found if err is returned, so that the connections fail to verify
+// rather than fall back to plaintext.
+func parseServerSSLFrom(svc *v1.Service, rlt map[string]interface{}) error {
+	if !BackendTLSEnabled(svc) {
+		return nil
+	}
+	hostname := svc.Annotations[AnnotationBackendTLSHostname]
+	name := strings.Join([]string{svc.Namespace, svc.Name}, ".")
+	profile := map[string]interface{}{
+		"name":             name,
+		"defaultsFrom":     "/Common/serverssl",
+		"serverName":       hostname,
+		"authenticateName": hostname,
+		"peerCertMode":     "require",
+		"caFile":           "/Common/ca-bundle.crt",
+	}
+	rlt["ltm/profile/server-ssl/"+name] = profile
+
+	upload := func(filename, content, kind string) {
+		rlt["shared/file-transfer/uploads/"+filename] = map[string]interface{}{
+			"content": content,
+		}
+		rlt["sys/file/"+kind+"/"+filename] = map[string]interface{}{
+			"name":       filename,
+			"sourcePath": "file:/var/config/rest/downloads/" + filename,
+		}
+	}
+
+	errs := []string{}
+	if ca := svc.Annotations[AnnotationBackendTLSCACertificate]; ca != "" {
+		kn := strings.SplitN(ca, "/", 2)
+		var content []byte
+		switch {
+		case len(kn) != 2:
+			errs = append(errs, fmt.Sprintf("invalid %s: '%s', must be ConfigMap/<name> or Secret/<name>", AnnotationBackendTLSCACertificate, ca))
+		case kn[0] == "ConfigMap":
+			if cm := ActiveSIGs.GetConfigMap(utils.Keyname(svc.Namespace, kn[1])); cm != nil {
+				content = []byte(cm.Data["ca.crt"])
 			}
-			if match.QueryParams != nil {
-				for _, queryParam := range match.QueryParams {
-					matchType := gatewayv1beta1.QueryParamMatchExact
-					if queryParam.Type != nil {
-						matchType = *queryParam.Type
-					}
-					switch matchType {
-					case gatewayv1beta1.QueryParamMatchExact:
-						matchConditions = append(matchConditions, fmt.Sprintf(`[URI::query [HTTP::uri] "%s"] eq "%s"`, queryParam.Name, queryParam.Value))
-					case gatewayv1beta1.QueryParamMatchRegularExpression:
-						matchConditions = append(matchConditions, fmt.Sprintf(`[URI::query [HTTP::uri] "%s"] matches "%s"`, queryParam.Name, queryParam.Value))
-					}
-				}
+		case kn[0] == "Secret":
+			if scrt := ActiveSIGs.GetSecret(utils.Keyname(svc.Namespace, kn[1])); scrt != nil {
+				content = scrt.Data["ca.crt"]
 			}
-			ruleConditions = append(ruleConditions, strings.Join(matchConditions, " and "))
+		default:
+			errs = append(errs, fmt.Sprintf("invalid %s: '%s', must be ConfigMap/<name> or Secret/<name>", AnnotationBackendTLSCACertificate, ca))
 		}
-		ruleCondition := strings.Join(ruleConditions, " or ")
-		if ruleCondition == "" {
-			ruleCondition = "1 eq 1"
+		if len(kn) == 2 && len(content) == 0 && len(errs) == 0 {
+			errs = append(errs, fmt.Sprintf("ca.crt not found in %s %s", kn[0], utils.Keyname(svc.Namespace, kn[1])))
 		}
+		if len(content) > 0 {
+			hash := sha256.Sum256(content)
+			cafile := strings.Join([]string{"ca", svc.Namespace, kn[1], fmt.Sprintf("%x", hash[:4])}, ".") + ".crt"
+			upload(cafile, string(content), "ssl-cert")
+			profile["caFile"] = cafile
+		}
+	}
 
-		// filters
-		for _, filter := range rl.Filters {
-			switch filter.Type {
-			case gatewayv1beta1.HTTPRouteFilterRequestHeaderModifier:
-				if filter.RequestHeaderModifier != nil {
-					for _, mdr := range filter.RequestHeaderModifier.Add {
-						filterActions = append(filterActions, fmt.Sprintf("HTTP::header insert %s %s", mdr.Name, mdr.Value))
-					}
-					for _, mdr := range filter.RequestHeaderModifier.Remove {
-						filterActions = append(filterActions, fmt.Sprintf("HTTP::header remove %s", mdr))
-					}
-					for _, mdr := range filter.RequestHeaderModifier.Set {
-						filterActions = append(filterActions, fmt.Sprintf("HTTP::header replace %s %s", mdr.Name, mdr.Value))
-					}
-				}
-			case gatewayv1beta1.HTTPRouteFilterRequestMirror:
-				// filter.RequestMirror.BackendRef -> vs mirror?
-				return fmt.Errorf("filter type '%s' not supported", gatewayv1beta1.HTTPRouteFilterRequestMirror)
-			case gatewayv1beta1.HTTPRouteFilterRequestRedirect:
-				if rr := filter.RequestRedirect; rr != nil {
-					setScheme := `set rscheme "http"`
-					if rr.Scheme != nil {
-						setScheme = fmt.Sprintf(`set rscheme "%s"`, *rr.Scheme)
-					}
-					setHostName := `set rhostname "[HTTP::host]"`
-					if rr.Hostname != nil {
-						setHostName = fmt.Sprintf(`set rhostname "%s"`, *rr.Hostname)
-					}
+	if cert := svc.Annotations[AnnotationBackendTLSClientCertificate]; cert != "" {
+		scrt := ActiveSIGs.GetSecret(utils.Keyname(svc.Namespace, cert))
+		if scrt == nil || len(scrt.Data[v1.TLSCertKey]) == 0 || len(scrt.Data[v1.TLSPrivateKeyKey]) == 0 {
+			errs = append(errs, fmt.Sprintf("client certificate secret %s not found or invalid", utils.Keyname(svc.Namespace, cert)))
+		} else {
+			sname := secretName(scrt)
+			upload(sname+".crt", string(scrt.Data[v1.TLSCertKey]), "ssl-cert")
+			upload(sname+".key", string(scrt.Data[v1.TLSPrivateKeyKey]), "ssl-key")
+			profile["cert"] = sname + ".crt"
+			profile["key"] = sname + ".key"
+		}
+	}
 
-					// experimental .. definition is not clear yet.
-					setUri := `set ruri "[HTTP::uri]"`
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// CheckBackendTLS returns the errors of the backend TLS configured by svc.
+func CheckBackendTLS(svc *v1.Service) error {
+	return parseServerSSLFrom(svc, map[string]interface{}{})
+}
+
+// serverSSLRule returns the iRule which picks the server-ssl profile of the
+// selected pool, the TLS is disabled for the other pools.
+func serverSSLRule(partition string, svcKeys []string) string {
+	cases := []string{}
+	for _, key := range svcKeys {
+		name := strings.Replace(key, "/", ".", 1)
+		cases = append(cases, fmt.Sprintf(`"/%s/%s" { SSL::profile /%s/%s }`, partition, name, partition, name))
+	}
+	return fmt.Sprintf(`
+		when SERVER_CONNECTED {
+			switch -- [LB::server pool] {
+				%s
+				default { SSL::disable serverside }
+			}
+		}
+	`, strings.Join(cases, "\n\t\t\t\t"))
+}
+
+// PoolOptionsOfAnnotations returns the properties of the pool and of its members
+// configured by the annotations of the service.
+func PoolOptionsOfAnnotations(annotations map[string]string) (map[string]interface{}, map[string]interface{}, error) {
+	poolOpts, memberOpts := map[string]interface{}{}, map[string]interface{}{}
+
+	if v, ok := annotations[AnnotationLBMethod]; ok {
+		modes := map[string]string{
+			"round-robin":       "round-robin",
+			"least-connections": "least-connections-member",
+			"ratio":             "ratio-member",
+			"fastest":           "fastest-app-response",
+		}
+		if mode, found := modes[v]; !found {
+			return nil, nil, fmt.Errorf("invalid %s: '%s', must be round-robin, least-connections, ratio or fastest", AnnotationLBMethod, v)
+		} else {
+			poolOpts["loadBalancingMode"] = mode
+		}
+	}
+
+	for _, item := range []struct {
+		annotation string
+		opts       map[string]interface{}
+		key        string
+	}{
+		{AnnotationSlowRampTime, poolOpts, "slowRampTime"},
+		{AnnotationConnectionLimit, memberOpts, "connectionLimit"},
+		{AnnotationRateLimit, memberOpts, "rateLimit"},
+	} {
+		if v, ok := annotations[item.annotation]; ok {
+			if n, err := strconv.Atoi(v); err != nil || n < 0 {
+				return nil, nil, fmt.Errorf("invalid %s: '%s', must be a non-negative integer", item.annotation, v)
+			} else if item.key == "rateLimit" {
+				// the rate limit of pool members is a string, "disabled" or the number.
+				item.opts[item.key] = v
+			} else {
+				item.opts[item.key] = n
+			}
+		}
+	}
+	return poolOpts, memberOpts, nil
+}
+
+// persistenceOf returns the persistence of the members of the pool of svc,
+// nil if no persistence is configured.
+func persistenceOf(svc *v1.Service) (*backendPersistence, error) {
+	if svc == nil {
+		return nil, nil
+	}
+	method, ok := svc.Annotations[AnnotationPersistence]
+	if !ok || method == "none" {
+		return nil, nil
+	}
+
+	timeout := 0
+	if v, ok := svc.Annotations[AnnotationPersistenceTimeout]; ok {
+		if n, err := strconv.Atoi(v); err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid %s: '%s', must be a non-negative integer", AnnotationPersistenceTimeout, v)
+		} else {
+			timeout = n
+		}
+	}
+	switch method {
+	case "cookie":
+		cookie := svc.Annotations[AnnotationPersistenceCookieName]
+		if cookie == "" {
+			cookie = strings.Join([]string{"f5-persist", svc.Namespace, svc.Name}, "-")
+		}
+		// the cookie expires with the session if timeout is 0.
+		return &backendPersistence{method: method, cookie: cookie, timeout: timeout}, nil
+	case "source-address":
+		if timeout == 0 {
+			timeout = 180
+		}
+		return &backendPersistence{method: method, timeout: timeout}, nil
+	default:
+		return nil, fmt.Errorf("invalid %s: '%s', must be cookie, source-address or none", AnnotationPersistence, method)
+	}
+}
+
+// command returns the iRule command which persists the requests to the members.
+func (p *backendPersistence) command() string {
+	if p == nil {
+		return ""
+	}
+	if p.method == "cookie" {
+		return fmt.Sprintf(`persist cookie insert "%s" %d`, p.cookie, p.timeout)
+	}
+	return fmt.Sprintf(`persist source_addr %d`, p.timeout)
+}
+
+// persistProfilesOf returns the persistence profile of the virtual of the
+// listener routing to the persistent services, which the persist commands of
+// the iRule require. The cookie one is preferred if both are used.
+func persistProfilesOf(hrs []*gatewayv1beta1.HTTPRoute) []interface{} {
+	profile := ""
+	for _, hr := range hrs {
+		for _, rl := range hr.Spec.Rules {
+			for _, br := range rl.BackendRefs {
+				ns := hr.Namespace
+				if br.Namespace != nil {
+					ns = string(*br.Namespace)
+				}
+				persist, _ := persistenceOf(ActiveSIGs.GetService(utils.Keyname(ns, string(br.Name))))
+				switch {
+				case persist == nil:
+				case persist.method == "cookie":
+					profile = "/Common/cookie"
+				case profile == "":
+					profile = "/Common/source_addr"
+				}
+			}
+		}
+	}
+	if profile == "" {
+		return []interface{}{}
+	}
+	return []interface{}{map[string]string{"name": profile, "tmDefault": "yes"}}
+}
+
+// CheckBackendOptions returns the errors of the load balancing and persistence
+// configured by svc.
+func CheckBackendOptions(svc *v1.Service) error {
+	if _, _, err := PoolOptionsOfAnnotations(svc.Annotations); err != nil {
+		return err
+	}
+	_, err := persistenceOf(svc)
+	return err
+}
+
+// MonitorOfAnnotations returns the monitor type and properties configured by the
+// annotations of the service.
+func MonitorOfAnnotations(annotations map[string]string) (string, map[string]interface{}, error) {
+	mtype := annotations[AnnotationMonitorType]
+	send, recv := annotations[AnnotationMonitorSend], annotations[AnnotationMonitorReceive]
+	switch mtype {
+	case "http", "https":
+		if send == "" {
+			send = "GET / HTTP/1.0\\r\\n\\r\\n"
+		}
+		if status, ok := annotations[AnnotationMonitorExpectedStatus]; ok {
+			if recv != "" {
+				return "", nil, fmt.Errorf("%s and %s cannot be both set", AnnotationMonitorReceive, AnnotationMonitorExpectedStatus)
+			}
+			if code, err := strconv.Atoi(status); err != nil || code < 100 || code > 599 {
+				return "", nil, fmt.Errorf("invalid %s: '%s'", AnnotationMonitorExpectedStatus, status)
+			}
+			recv = fmt.Sprintf("^HTTP/1\\.[01] %s", status)
+		}
+	case "tcp", "udp":
+		if _, ok := annotations[AnnotationMonitorExpectedStatus]; ok {
+			return "", nil, fmt.Errorf("%s is only for http and https monitors", AnnotationMonitorExpectedStatus)
+		}
+	case "icmp":
+		if send != "" || recv != "" {
+			return "", nil, fmt.Errorf("%s and %s are not for icmp monitors", AnnotationMonitorSend, AnnotationMonitorReceive)
+		}
+		mtype = "gateway-icmp"
+	default:
+		return "", nil, fmt.Errorf("invalid %s: '%s', must be http, https, tcp, udp or icmp", AnnotationMonitorType, mtype)
+	}
+
+	interval, timeout := 5, 16
+	for _, item := range []struct {
+		annotation string
+		value      *int
+	}{{AnnotationMonitorInterval, &interval}, {AnnotationMonitorTimeout, &timeout}} {
+		if v, ok := annotations[item.annotation]; ok {
+			if n, err := strconv.Atoi(v); err != nil || n <= 0 {
+				return "", nil, fmt.Errorf("invalid %s: '%s', must be a positive integer", item.annotation, v)
+			} else {
+				*item.value = n
+			}
+		}
+	}
+	if timeout <= interval {
+		return "", nil, fmt.Errorf("%s must be larger than %s", AnnotationMonitorTimeout, AnnotationMonitorInterval)
+	}
+
+	monitor := map[string]interface{}{
+		"defaultsFrom": "/Common/" + strings.Replace(mtype, "-", "_", 1),
+		"interval":     interval,
+		"timeout":      timeout,
+	}
+	if mtype != "gateway-icmp" {
+		monitor["send"] = send
+		monitor["recv"] = recv
+	}
+	return mtype, monitor, nil
+}
+
+// monitorOfProbe returns the monitor equivalent to the readiness probe, nil
+// for the exec and grpc probes. The kubelet marks the pod unready after
+// failureThreshold failed probes, which is the timeout of the monitor.
+func monitorOfProbe(probe *v1.Probe) (string, map[string]interface{}) {
+	period, failures, timeout := 10, 3, 1
+	if probe.PeriodSeconds > 0 {
+		period = int(probe.PeriodSeconds)
+	}
+	if probe.FailureThreshold > 0 {
+		failures = int(probe.FailureThreshold)
+	}
+	if probe.TimeoutSeconds > 0 {
+		timeout = int(probe.TimeoutSeconds)
+	}
+	monitor := map[string]interface{}{
+		"interval": period,
+		"timeout":  period*failures + timeout,
+	}
+	destination := func(port intstr.IntOrString) {
+		if port.Type == intstr.Int {
+			monitor["destination"] = fmt.Sprintf("*:%d", port.IntVal)
+		}
+	}
+
+	switch {
+	case probe.HTTPGet != nil:
+		hg := probe.HTTPGet
+		mtype := "http"
+		if hg.Scheme == v1.URISchemeHTTPS {
+			mtype = "https"
+		}
+		path, host, headers := hg.Path, hg.Host, ""
+		if path == "" {
+			path = "/"
+		}
+		if host == "" {
+			host = "localhost"
+		}
+		for _, h := range hg.HTTPHeaders {
+			headers += fmt.Sprintf("%s: %s\\r\\n", h.Name, h.Value)
+		}
+		monitor["defaultsFrom"] = "/Common/" + mtype
+		monitor["send"] = fmt.Sprintf("GET %s HTTP/1.1\\r\\nHost: %s\\r\\n%sConnection: Close\\r\\n\\r\\n", path, host, headers)
+		// the kubelet takes the status codes in [200, 400) as success.
+		monitor["recv"] = "^HTTP/1\\.[01] [23][0-9][0-9]"
+		destination(hg.Port)
+		return mtype, monitor
+	case probe.TCPSocket != nil:
+		monitor["defaultsFrom"] = "/Common/tcp"
+		destination(probe.TCPSocket.Port)
+		return "tcp", monitor
+	default:
+		return "", nil
+	}
+}
+
+func parseMembersFrom(svcNamespace, svcName string) ([]interface{}, error) {
+	svc := ActiveSIGs.GetService(utils.Keyname(svcNamespace, svcName))
+	eps := ActiveSIGs.GetEndpoints(utils.Keyname(svcNamespace, svcName))
+	if svc != nil && eps != nil {
+		if mbs, err := k8s.FormatMembersFromServiceEndpoints(svc, eps); err != nil {
+			return []interface{}{}, err
+		} else {
+			fmtmbs := []interface{}{}
+
+			for _, mb := range mbs {
+				sep := ":"
+				if utils.IsIpv6(mb.IpAddr) {
+					sep = "."
+				}
+				fmtmbs = append(fmtmbs, map[string]interface{}{
+					"name":    fmt.Sprintf("%s%s%d", mb.IpAddr, sep, mb.TargetPort),
+					"address": mb.IpAddr,
+				})
+			}
+			return fmtmbs, nil
+		}
+	} else {
+		return []interface{}{}, nil
+	}
+}
+
+func parseArpsFrom(svcNamespace, svcName string, rlt map[string]interface{}) error {
+	svc := ActiveSIGs.GetService(utils.Keyname(svcNamespace, svcName))
+	eps := ActiveSIGs.GetEndpoints(utils.Keyname(svcNamespace, svcName))
+	if svc != nil && eps != nil {
+		if mbs, err := k8s.FormatMembersFromServiceEndpoints(svc, eps); err != nil {
+			return err
+		} else {
+			prefix := "k8s-"
+			for _, mb := range mbs {
+				if mb.MacAddr != "" {
+					rlt["net/arp/"+prefix+mb.IpAddr] = map[string]interface{}{
+						"name":       prefix + mb.IpAddr,
+						"ipAddress":  mb.IpAddr,
+						"macAddress": mb.MacAddr,
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func parseNodesFrom(svcNamespace, svcName string, rlt map[string]interface{}) error {
+	svc := ActiveSIGs.GetService(utils.Keyname(svcNamespace, svcName))
+	eps := ActiveSIGs.GetEndpoints(utils.Keyname(svcNamespace, svcName))
+	if svc != nil && eps != nil {
+		if mbs, err := k8s.FormatMembersFromServiceEndpoints(svc, eps); err != nil {
+			return err
+		} else {
+			for _, mb := range mbs {
+				if mb.MacAddr != "" {
+					rlt["ltm/node/"+mb.IpAddr] = map[string]interface{}{
+						"name":    mb.IpAddr,
+						"address": mb.IpAddr,
+						"monitor": "default",
+						"session": "user-enabled",
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// parseiRuleActionsFrom returns the iRule actions of the rules of hr, indexed
+// by the rules. The invalid rules are left nil, so that the others still work.
+func parseiRuleActionsFrom(partition string, hr *gatewayv1beta1.HTTPRoute) ([]*iRuleAction, error) {
+	name := hrName(hr)
+
+	ruleActions := make([]*iRuleAction, len(hr.Spec.Rules))
+	ruleErrs := []string{}
+nextRule:
+	for i, rl := range hr.Spec.Rules {
+		filterActions := []string{}
+		responseActions := []string{}
+		poolWeights := []string{}
+		persists := []string{}
+		cookiePools := []string{}
+		sourcePersisted := false
+		mirrored := false
+
+		// filters
+		for _, filter := range rl.Filters {
+			switch filter.Type {
+			case gatewayv1beta1.HTTPRouteFilterRequestHeaderModifier:
+				if filter.RequestHeaderModifier != nil {
+					for _, mdr := range filter.RequestHeaderModifier.Add {
+						filterActions = append(filterActions, fmt.Sprintf("HTTP::header insert %s %s", tclQuoted(string(mdr.Name)), tclQuoted(mdr.Value)))
+					}
+					for _, mdr := range filter.RequestHeaderModifier.Remove {
+						filterActions = append(filterActions, fmt.Sprintf("HTTP::header remove %s", tclQuoted(mdr)))
+					}
+					for _, mdr := range filter.RequestHeaderModifier.Set {
+						filterActions = append(filterActions, fmt.Sprintf("HTTP::header replace %s %s", tclQuoted(string(mdr.Name)), tclQuoted(mdr.Value)))
+					}
+				}
+			case gatewayv1beta1.HTTPRouteFilterResponseHeaderModifier:
+				if filter.ResponseHeaderModifier != nil {
+					for _, mdr := range filter.ResponseHeaderModifier.Add {
+						responseActions = append(responseActions, fmt.Sprintf("HTTP::header insert %s %s", tclQuoted(string(mdr.Name)), tclQuoted(mdr.Value)))
+					}
+					for _, mdr := range filter.ResponseHeaderModifier.Remove {
+						responseActions = append(responseActions, fmt.Sprintf("HTTP::header remove %s", tclQuoted(mdr)))
+					}
+					for _, mdr := range filter.ResponseHeaderModifier.Set {
+						responseActions = append(responseActions, fmt.Sprintf("HTTP::header replace %s %s", tclQuoted(string(mdr.Name)), tclQuoted(mdr.Value)))
+					}
+				}
+			case gatewayv1beta1.HTTPRouteFilterRequestMirror:
+				if rm := filter.RequestMirror; rm != nil {
+					br := rm.BackendRef
+					if (br.Group != nil && *br.Group != "") || (br.Kind != nil && *br.Kind != "Service") {
+						ruleErrs = append(ruleErrs, fmt.Sprintf("rule %d: mirror backendRef '%s' is not a Service", i, br.Name))
+						continue nextRule
+					}
+					// the refs not permitted are reported in the ResolvedRefs condition.
+					if !ActiveSIGs.ReferenceGranted(hrKind(hr), hr.Namespace, "Service", mirrorKeyOf(hr, &filter)) {
+						continue nextRule
+					}
+					// the request is sent in HTTP_REQUEST_DATA, once the payload is collected.
+					pool := fmt.Sprintf("/%s/%s", partition, strings.Replace(mirrorKeyOf(hr, &filter), "/", ".", 1))
+					filterActions = append(filterActions, fmt.Sprintf(`
+						set mirror_pool "%s"
+						set clen 0
+						if { [HTTP::header exists "Content-Length"] } {
+							set clen [HTTP::header "Content-Length"]
+						}
+						if { $clen > 0 && $clen <= 1048576 } {
+							HTTP::collect $clen
+						} else {
+							call mirror $mirror_pool [HTTP::request]
+							unset mirror_pool
+						}
+					`, pool))
+					mirrored = true
+				}
+			case gatewayv1beta1.HTTPRouteFilterRequestRedirect:
+				if rr := filter.RequestRedirect; rr != nil {
+					setScheme := `set rscheme "http"`
+					if rr.Scheme != nil {
+						setScheme = fmt.Sprintf(`set rscheme "%s"`, *rr.Scheme)
+					}
+					setHostName := `set rhostname "[HTTP::host]"`
+					if rr.Hostname != nil {
+						setHostName = fmt.Sprintf(`set rhostname "%s"`, *rr.Hostname)
+					}
+
+					// experimental .. definition is not clear yet.
+					setUri := `set ruri "[HTTP::uri]"`
 					if rr.Path != nil && rr.Path.ReplaceFullPath != nil {
 						setUri = fmt.Sprintf(`set ruri "%s"`, *rr.Path.ReplaceFullPath)
 					}
@@ -403,10 +1189,13 @@ func parseiRulesFrom(className string, hr *gatewayv1beta1.HTTPRoute, rlt map[str
 						setPort = fmt.Sprintf(`set rport %d`, *rr.Port)
 					}
 
+					statusCode := 302
 					if rr.StatusCode != nil {
 						if *rr.StatusCode != 301 && *rr.StatusCode != 302 {
-							return fmt.Errorf("invalid status %d for request redirect", *rr.StatusCode)
+							ruleErrs = append(ruleErrs, fmt.Sprintf("rule %d: invalid status %d for request redirect", i, *rr.StatusCode))
+							continue nextRule
 						}
+						statusCode = *rr.StatusCode
 					}
 					filterActions = append(filterActions, fmt.Sprintf(`
 						%s
@@ -414,33 +1203,28 @@ func parseiRulesFrom(className string, hr *gatewayv1beta1.HTTPRoute, rlt map[str
 						%s
 						%s
 						set url $rscheme://$rhostname:$rport$ruri
-						log local0. "request redirect to $url"
 						HTTP::respond %d Location $url
-					`, setScheme, setHostName, setUri, setPort, *rr.StatusCode))
+					`, setScheme, setHostName, setUri, setPort, statusCode))
 				}
 			// <gateway:experimental>
-			// case gatewayv1beta1.HTTPRouteFilterURLRewrite:
-			// 	if ur := filter.URLRewrite; ur != nil {
-			// 		setHostname := `set rhostname [HTTP::host]`
-			// 		if ur.Hostname != nil {
-			// 			setHostname = fmt.Sprintf(`set rhostname "%s"`, *ur.Hostname)
-			// 		}
-			// 		// experimental .. definition is not clear yet.
-			// 		setPath := `set rpath [HTTP::path]`
-			// 		if ur.Path != nil && ur.Path.ReplaceFullPath != nil {
-			// 			setPath = fmt.Sprintf(`set rpath "%s"`, *ur.Path.ReplaceFullPath)
-			// 		}
-			// 		filterActions = append(filterActions, fmt.Sprintf(`
-			// 			%s
-			// 			%s
-			// 			[HTTP::header replace Host $rhostname]
-			// 			HTTP::uri $rpath
-			// 		`, setHostname, setPath))
-			// 	}
+			case gatewayv1beta1.HTTPRouteFilterURLRewrite:
+				if ur := filter.URLRewrite; ur != nil {
+					if ur.Hostname != nil {
+						filterActions = append(filterActions, fmt.Sprintf(`HTTP::header replace Host "%s"`, *ur.Hostname))
+					}
+					if ur.Path != nil {
+						if action, err := parsePathModifier(ur.Path, rl.Matches); err != nil {
+							ruleErrs = append(ruleErrs, fmt.Sprintf("rule %d: %s", i, err.Error()))
+							continue nextRule
+						} else {
+							filterActions = append(filterActions, action)
+						}
+					}
+				}
 			case gatewayv1beta1.HTTPRouteFilterExtensionRef:
 				if er := filter.ExtensionRef; er != nil {
 					pool := fmt.Sprintf("%s.%s", hr.Namespace, er.Name)
-					filterActions = append(filterActions, fmt.Sprintf("pool /%s/%s", "cis-c-tenant", pool))
+					filterActions = append(filterActions, fmt.Sprintf("pool /%s/%s", partition, pool))
 				}
 			}
 		}
@@ -451,13 +1235,41 @@ func parseiRulesFrom(className string, hr *gatewayv1beta1.HTTPRoute, rlt map[str
 			if br.Namespace != nil {
 				ns = string(*br.Namespace)
 			}
+			// the refs not permitted are reported in the ResolvedRefs condition, the
+			// requests to the rule are answered with 500 rather than the next rules.
+			if !ActiveSIGs.ReferenceGranted(hrKind(hr), hr.Namespace, "Service", utils.Keyname(ns, string(br.Name))) {
+				ruleActions[i] = &iRuleAction{action: `
+				HTTP::respond 500
+				return
+			`}
+				continue nextRule
+			}
 			pn := strings.Join([]string{ns, string(br.Name)}, ".")
-			pool := fmt.Sprintf("/%s/%s", "cis-c-tenant", pn)
+			pool := fmt.Sprintf("/%s/%s", partition, pn)
 			weight := 1
 			if br.Weight != nil {
 				weight = int(*br.Weight)
 			}
 			poolWeights = append(poolWeights, fmt.Sprintf("%s %d", pool, weight))
+			// the invalid persistence is reported by the service controller.
+			if persist, err := persistenceOf(ActiveSIGs.GetService(utils.Keyname(ns, string(br.Name)))); err == nil && persist != nil {
+				persists = append(persists, fmt.Sprintf(`"%s" { %s }`, pool, persist.command()))
+				if persist.method == "cookie" {
+					cookiePools = append(cookiePools, fmt.Sprintf(`"%s" "%s"`, persist.cookie, pool))
+				} else {
+					sourcePersisted = true
+				}
+			}
+		}
+		// the persistence profile of the virtual is not applied to the other pools.
+		persistAction := "persist none"
+		if len(persists) > 0 {
+			persistAction = fmt.Sprintf(`
+				switch -- $pool {
+					%s
+					default { persist none }
+				}
+			`, strings.Join(persists, "\n\t\t\t\t\t"))
 		}
 
 		namedi := strings.ReplaceAll(fmt.Sprintf("%s_%d", name, i), ".", "_")
@@ -478,44 +1290,796 @@ func parseiRulesFrom(className string, hr *gatewayv1beta1.HTTPRoute, rlt map[str
 			set static::pools_%s_size [array size static::pools_%s]
 		`, namedi, strings.Join(poolWeights, " "), namedi, namedi, namedi)
 
-		rules = append(rules, fmt.Sprintf(`	
-			if { %s } {
+		// the response of the rule is modified in HTTP_RESPONSE, which is told
+		// the rule by the variable set in HTTP_REQUEST.
+		response := map[string]string{}
+		if len(responseActions) > 0 {
+			response[namedi] = strings.Join(responseActions, "\n")
+			filterAction = fmt.Sprintf("set response_rule %s\n%s", namedi, filterAction)
+		}
+
+		// the pool is picked by the persistence before the weights, otherwise
+		// the requests persisted to a member may be sent to another pool.
+		pick := fmt.Sprintf(`set pool $static::pools_%s([expr {int(rand()*$static::pools_%s_size)}])`, namedi, namedi)
+		if sourcePersisted {
+			pick = fmt.Sprintf(`set pool $static::pools_%s([expr {[crc32 [IP::client_addr]] %% $static::pools_%s_size}])`, namedi, namedi)
+		}
+		if len(cookiePools) > 0 {
+			pick = fmt.Sprintf(`
+				set pool ""
+				foreach { cookie cpool } { %s } {
+					if { [HTTP::cookie exists $cookie] } {
+						set pool $cpool
+						break
+					}
+				}
+				if { $pool eq "" } {
+					%s
+				}
+			`, strings.Join(cookiePools, " "), pick)
+		}
+
+		ruleActions[i] = &iRuleAction{
+			init: ruleInit,
+			action: fmt.Sprintf(`
+				%s
+				%s
+				pool $pool
+				%s
+				return
+			`, filterAction, pick, persistAction),
+			response: response,
+			mirrored: mirrored,
+		}
+	}
+
+	if len(ruleErrs) > 0 {
+		return ruleActions, fmt.Errorf("invalid rules skipped: %s", strings.Join(ruleErrs, "; "))
+	}
+	return ruleActions, nil
+}
+
+// parseDispatchRuleFrom returns the iRule of the HTTP(S) listener, which
+// dispatches the requests to the branches of the attached httproutes in order.
+// The requests not matching any branch are logged as the gateway configures.
+func parseDispatchRuleFrom(vsname, partition string, listener *gatewayv1beta1.Listener, branches []httpBranch, gwLogging *requestLogging) map[string]interface{} {
+	routeActions := map[string][]*iRuleAction{}
+	ruleInits := []string{}
+	conditions := []string{}
+	responses := []string{}
+	mirrored, logged := false, false
+	for _, b := range branches {
+		key := hrName(b.hr)
+		if _, ok := routeActions[key]; !ok {
+			// the invalid rules are reported in the status of the httproute.
+			routeActions[key], _ = parseiRuleActionsFrom(partition, b.hr)
+			for _, ra := range routeActions[key] {
+				if ra != nil {
+					ruleInits = append(ruleInits, ra.init)
+					mirrored = mirrored || ra.mirrored
+					for rule, actions := range ra.response {
+						responses = append(responses, fmt.Sprintf("%s {\n%s\n}", rule, actions))
+					}
+				}
+			}
+		}
+		ra := routeActions[key][b.ruleIndex]
+		if ra == nil {
+			continue
+		}
+		logging := routeLogging(gwLogging, b.hr)
+		logged = logged || logging != nil
+		conditions = append(conditions, fmt.Sprintf(`
+			if { (%s) and (%s) } {
 				%s
 				%s
 			}
-		`, ruleCondition, filterAction, fmt.Sprintf(`
-			set pool $static::pools_%s([expr {int(rand()*$static::pools_%s_size)}])
-			pool $pool
-			return
-		`, namedi, namedi)))
+		`, iRuleHostnameCondition(b.hr), iRuleMatchCondition(b.match), iRuleLoggingCall(logging, key), ra.action))
+	}
+	logged = logged || gwLogging != nil
+	conditions = append(conditions, iRuleLoggingCall(gwLogging, ""))
 
-		ruleInits = append(ruleInits, ruleInit)
+	listenerCheck := ""
+	if listener.Hostname != nil {
+		listenerCheck = fmt.Sprintf(`
+			if { not ([HTTP::host] matches "%s") } {
+				return
+			}
+		`, *listener.Hostname)
 	}
 
-	ruleObj := map[string]interface{}{
-		"name": name,
+	mirrorRule := ""
+	if mirrored {
+		mirrorRule = `
+		proc mirror { mpool request } {
+			set members [active_members -list $mpool]
+			if { [llength $members] == 0 } {
+				return
+			}
+			set member [lindex $members [expr {int(rand()*[llength $members])}]]
+			set dest "[lindex $member 0]:[lindex $member 1]"
+			if { [string first ":" [lindex $member 0]] >= 0 } {
+				set dest "[lindex $member 0].[lindex $member 1]"
+			}
+			if { [catch {connect -protocol TCP -timeout 100 -idle 5 $dest} conn] } {
+				return
+			}
+			send -timeout 100 $conn $request
+			close $conn
+		}
+		when HTTP_REQUEST_DATA {
+			if { [info exists mirror_pool] } {
+				call mirror $mirror_pool "[HTTP::request][HTTP::payload]"
+				unset mirror_pool
+			}
+		}
+		`
+	}
+
+	responseRule, responseInit := "", ""
+	if len(responses) > 0 {
+		// the variable is kept across the requests of a connection, it's reset for each request.
+		responseInit = `set response_rule ""`
+		responseRule = fmt.Sprintf(`
+		when HTTP_RESPONSE {
+			switch -- $response_rule {
+				%s
+			}
+		}
+		`, strings.Join(responses, "\n"))
+	}
+
+	logRule := ""
+	if logged {
+		logRule = `
+		proc reqlog { route hslpool redacted } {
+			set headers {}
+			foreach header [HTTP::header names] {
+				if { [lsearch -exact $redacted [string tolower $header]] >= 0 } {
+					lappend headers "$header=\"***\""
+				} else {
+					lappend headers "$header=\"[HTTP::header value $header]\""
+				}
+			}
+			set msg "route=\"$route\" client=\"[IP::client_addr]\" host=\"[HTTP::host]\" method=\"[HTTP::method]\" uri=\"[HTTP::uri]\" headers=\{[join $headers { }]\}"
+			if { $hslpool ne "" } {
+				HSL::send [HSL::open -proto UDP -pool $hslpool] "<134>$msg\n"
+			} else {
+				log local0. $msg
+			}
+		}
+		`
+	}
+
+	return map[string]interface{}{
+		"name": vsname,
 		"apiAnonymous": fmt.Sprintf(`
+		%s
+		%s
 		when RULE_INIT {
 			%s
 		}
 		when HTTP_REQUEST {
-			log local0. "request host: [HTTP::host], uri: [HTTP::uri], path: [HTTP::path], method: [HTTP::method]"
-			log local0. "headers: [HTTP::header names]"
-			foreach header [HTTP::header names] {
-				log local0. "$header: [HTTP::header value $header]"
+			%s
+			%s
+			%s
+		}
+		%s
+	`, mirrorRule, logRule, strings.Join(ruleInits, "\n"), responseInit, listenerCheck, strings.Join(conditions, "\n"), responseRule),
+	}
+}
+
+// requestLoggingOf returns the request logging configured by the annotations,
+// nil if it is off. set tells whether the logging is configured at all.
+func requestLoggingOf(annotations map[string]string) (logging *requestLogging, set bool, err error) {
+	v, set := annotations[AnnotationRequestLogging]
+	if !set {
+		return nil, false, nil
+	}
+	switch v {
+	case "on", "true":
+	case "off", "false":
+		return nil, true, nil
+	default:
+		return nil, true, fmt.Errorf("invalid %s: '%s', must be on or off", AnnotationRequestLogging, v)
+	}
+
+	logging = &requestLogging{
+		sampleRate:    1,
+		redactHeaders: []string{"authorization", "proxy-authorization", "cookie", "set-cookie"},
+		hslPool:       annotations[AnnotationRequestLoggingHSLPool],
+	}
+	if v, ok := annotations[AnnotationRequestLoggingSampleRate]; ok {
+		if rate, err := strconv.ParseFloat(v, 64); err != nil || rate <= 0 || rate > 1 {
+			return nil, true, fmt.Errorf("invalid %s: '%s', must be in (0, 1]", AnnotationRequestLoggingSampleRate, v)
+		} else {
+			logging.sampleRate = rate
+		}
+	}
+	if v, ok := annotations[AnnotationRequestLoggingRedactHeaders]; ok {
+		for _, h := range strings.Split(v, ",") {
+			if h = strings.ToLower(strings.TrimSpace(h)); h != "" && !contains(logging.redactHeaders, h) {
+				logging.redactHeaders = append(logging.redactHeaders, h)
 			}
-			log local0. "queryparams: [HTTP::query]"
-			if { %s } {
-				%s
+		}
+	}
+	if logging.hslPool != "" && !strings.HasPrefix(logging.hslPool, "/") {
+		return nil, true, fmt.Errorf("invalid %s: '%s', must be the full path of the pool", AnnotationRequestLoggingHSLPool, logging.hslPool)
+	}
+	return logging, true, nil
+}
+
+// routeLogging returns the request logging of hr, which inherits the one of the
+// gateway unless configured. The invalid configurations are reported in the status.
+func routeLogging(gwLogging *requestLogging, hr *gatewayv1beta1.HTTPRoute) *requestLogging {
+	logging, set, err := requestLoggingOf(hr.Annotations)
+	if err != nil {
+		return nil
+	}
+	if !set {
+		return gwLogging
+	}
+	return logging
+}
+
+func iRuleLoggingCall(logging *requestLogging, route string) string {
+	if logging == nil {
+		return ""
+	}
+	call := fmt.Sprintf(`call reqlog "%s" "%s" {%s}`, route, logging.hslPool, strings.Join(logging.redactHeaders, " "))
+	if logging.sampleRate < 1 {
+		call = fmt.Sprintf(`if { rand() < %g } { %s }`, logging.sampleRate, call)
+	}
+	return call
+}
+
+func iRuleHostnameCondition(hr *gatewayv1beta1.HTTPRoute) string {
+	hostnameConditions := []string{}
+	for _, hn := range hr.Spec.Hostnames {
+		hostnameConditions = append(hostnameConditions, fmt.Sprintf(`[HTTP::host] matches "%s"`, hn))
+	}
+	if len(hostnameConditions) == 0 {
+		return "1 eq 1"
+	}
+	return strings.Join(hostnameConditions, " or ")
+}
+
+// iRuleMatchCondition returns the condition of the match, nil matches all.
+func iRuleMatchCondition(match *gatewayv1beta1.HTTPRouteMatch) string {
+	if match == nil {
+		return "1 eq 1"
+	}
+	matchConditions := []string{}
+	if match.Path != nil {
+		matchType := gatewayv1beta1.PathMatchPathPrefix
+		if match.Path.Type != nil {
+			matchType = *match.Path.Type
+		}
+		switch matchType {
+		case gatewayv1beta1.PathMatchPathPrefix:
+			matchConditions = append(matchConditions, fmt.Sprintf(`[HTTP::path] starts_with "%s"`, *match.Path.Value))
+		case gatewayv1beta1.PathMatchExact:
+			matchConditions = append(matchConditions, fmt.Sprintf(`[HTTP::path] eq "%s"`, *match.Path.Value))
+		case gatewayv1beta1.PathMatchRegularExpression:
+			matchConditions = append(matchConditions, fmt.Sprintf(`[HTTP::path] matches "%s"`, *match.Path.Value))
+		}
+	}
+	for _, header := range match.Headers {
+		matchType := gatewayv1beta1.HeaderMatchExact
+		if header.Type != nil {
+			matchType = *header.Type
+		}
+		switch matchType {
+		case gatewayv1beta1.HeaderMatchExact:
+			matchConditions = append(matchConditions, fmt.Sprintf(`[HTTP::header "%s"] eq "%s"`, header.Name, header.Value))
+		case gatewayv1beta1.HeaderMatchRegularExpression:
+			matchConditions = append(matchConditions, fmt.Sprintf(`[HTTP::header "%s"] matches "%s"`, header.Name, header.Value))
+		}
+	}
+	if match.Method != nil {
+		matchConditions = append(matchConditions, fmt.Sprintf(`[HTTP::method] eq "%s"`, *match.Method))
+	}
+	for _, queryParam := range match.QueryParams {
+		matchType := gatewayv1beta1.QueryParamMatchExact
+		if queryParam.Type != nil {
+			matchType = *queryParam.Type
+		}
+		switch matchType {
+		case gatewayv1beta1.QueryParamMatchExact:
+			matchConditions = append(matchConditions, fmt.Sprintf(`[URI::query [HTTP::uri] "%s"] eq "%s"`, queryParam.Name, queryParam.Value))
+		case gatewayv1beta1.QueryParamMatchRegularExpression:
+			matchConditions = append(matchConditions, fmt.Sprintf(`[URI::query [HTTP::uri] "%s"] matches "%s"`, queryParam.Name, queryParam.Value))
+		}
+	}
+	if len(matchConditions) == 0 {
+		return "1 eq 1"
+	}
+	return strings.Join(matchConditions, " and ")
+}
+
+// httpBranchesOf returns the branches of the httproutes in the order of the
+// match precedence: exact path, the longest prefix, method, the most headers,
+// the most query params, and then the oldest route. The ties within a route
+// are broken by the order of its rules and matches.
+func httpBranchesOf(hrs []*gatewayv1beta1.HTTPRoute) []httpBranch {
+	branches := []httpBranch{}
+	for _, hr := range hrs {
+		for i, rl := range hr.Spec.Rules {
+			if len(rl.Matches) == 0 {
+				branches = append(branches, httpBranch{hr: hr, ruleIndex: i})
+			}
+			for j := range rl.Matches {
+				branches = append(branches, httpBranch{hr: hr, ruleIndex: i, matchIndex: j, match: &hr.Spec.Rules[i].Matches[j]})
 			}
 		}
-	`, strings.Join(ruleInits, "\n"), hostnameCondition, strings.Join(rules, "\n")),
 	}
 
-	rlt["ltm/rule/"+name] = ruleObj
+	// the path without type or value is the prefix "/" by default.
+	pathOf := func(match *gatewayv1beta1.HTTPRouteMatch) (int, int) {
+		if match == nil || match.Path == nil || match.Path.Value == nil {
+			return 1, 1
+		}
+		switch {
+		case match.Path.Type != nil && *match.Path.Type == gatewayv1beta1.PathMatchExact:
+			return 0, len(*match.Path.Value)
+		case match.Path.Type != nil && *match.Path.Type == gatewayv1beta1.PathMatchRegularExpression:
+			return 2, len(*match.Path.Value)
+		default:
+			return 1, len(*match.Path.Value)
+		}
+	}
+	counts := func(match *gatewayv1beta1.HTTPRouteMatch) (int, int, int) {
+		if match == nil {
+			return 0, 0, 0
+		}
+		method := 0
+		if match.Method != nil {
+			method = 1
+		}
+		return method, len(match.Headers), len(match.QueryParams)
+	}
+	sort.SliceStable(branches, func(i, j int) bool {
+		a, b := branches[i], branches[j]
+		ta, la := pathOf(a.match)
+		tb, lb := pathOf(b.match)
+		if ta != tb {
+			return ta < tb
+		}
+		if la != lb {
+			return la > lb
+		}
+		ma, ha, qa := counts(a.match)
+		mb, hb, qb := counts(b.match)
+		if ma != mb {
+			return ma > mb
+		}
+		if ha != hb {
+			return ha > hb
+		}
+		if qa != qb {
+			return qa > qb
+		}
+		if a.hr != b.hr {
+			return olderThan(a.hr, b.hr)
+		}
+		if a.ruleIndex != b.ruleIndex {
+			return a.ruleIndex < b.ruleIndex
+		}
+		return a.matchIndex < b.matchIndex
+	})
+	return branches
+}
+
+// policyExpressible tells whether hr can be deployed as the rules of the
+// listeners' ltm policies, which are much cheaper than iRules. The weighted
+// splits, regular expressions, mirrors, rewrites, extensionRefs, the
+// redirects other than 302 and the persistent backends are left to the iRule.
+func policyExpressible(hr *gatewayv1beta1.HTTPRoute) bool {
+	for _, rl := range hr.Spec.Rules {
+		if len(rl.BackendRefs) > 1 {
+			return false
+		}
+		for _, br := range rl.BackendRefs {
+			if (br.Group != nil && *br.Group != "") || (br.Kind != nil && *br.Kind != "Service") {
+				return false
+			}
+			ns := hr.Namespace
+			if br.Namespace != nil {
+				ns = string(*br.Namespace)
+			}
+			// the persistence is done by the iRule.
+			if persist, _ := persistenceOf(ActiveSIGs.GetService(utils.Keyname(ns, string(br.Name)))); persist != nil {
+				return false
+			}
+			// the iRule answers 500 to the rules with the refs not permitted.
+			if !ActiveSIGs.ReferenceGranted(hrKind(hr), hr.Namespace, "Service", utils.Keyname(ns, string(br.Name))) {
+				return false
+			}
+		}
+		for _, match := range rl.Matches {
+			if match.Path != nil && match.Path.Type != nil && *match.Path.Type == gatewayv1beta1.PathMatchRegularExpression {
+				return false
+			}
+			for _, header := range match.Headers {
+				if header.Type != nil && *header.Type != gatewayv1beta1.HeaderMatchExact {
+					return false
+				}
+			}
+			for _, queryParam := range match.QueryParams {
+				if queryParam.Type != nil && *queryParam.Type != gatewayv1beta1.QueryParamMatchExact {
+					return false
+				}
+			}
+		}
+		for _, filter := range rl.Filters {
+			switch filter.Type {
+			case gatewayv1beta1.HTTPRouteFilterRequestHeaderModifier:
+			case gatewayv1beta1.HTTPRouteFilterRequestRedirect:
+				if rr := filter.RequestRedirect; rr != nil && rr.StatusCode != nil && *rr.StatusCode != 302 {
+					return false
+				}
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// parsePolicyRulesFrom returns the ltm policy rules of the branch on the listener.
+// The conditions of a policy rule are ANDed, so a rule is generated for each
+// group of the hostnames.
+func parsePolicyRulesFrom(b httpBranch, listener *gatewayv1beta1.Listener, partition string) []interface{} {
+	hr, rl := b.hr, b.hr.Spec.Rules[b.ruleIndex]
+	hostConditions := policyHostConditionsOf(listener.Hostname, hr.Spec.Hostnames)
+
+	actions := []map[string]interface{}{}
+	for _, filter := range rl.Filters {
+		switch filter.Type {
+		case gatewayv1beta1.HTTPRouteFilterRequestHeaderModifier:
+			if hm := filter.RequestHeaderModifier; hm != nil {
+				for _, mdr := range hm.Add {
+					actions = append(actions, map[string]interface{}{
+						"httpHeader": true, "insert": true, "tmName": string(mdr.Name), "value": mdr.Value,
+					})
+				}
+				for _, mdr := range hm.Remove {
+					actions = append(actions, map[string]interface{}{
+						"httpHeader": true, "remove": true, "tmName": mdr,
+					})
+				}
+				for _, mdr := range hm.Set {
+					actions = append(actions, map[string]interface{}{
+						"httpHeader": true, "replace": true, "tmName": string(mdr.Name), "value": mdr.Value,
+					})
+				}
+			}
+		case gatewayv1beta1.HTTPRouteFilterRequestRedirect:
+			if rr := filter.RequestRedirect; rr != nil {
+				scheme, hostname, port, uri := "http", "[HTTP::host]", "[TCP::local_port]", "[HTTP::uri]"
+				if rr.Scheme != nil {
+					scheme = *rr.Scheme
+				}
+				if rr.Hostname != nil {
+					hostname = string(*rr.Hostname)
+				}
+				if rr.Port != nil {
+					port = fmt.Sprintf("%d", *rr.Port)
+				}
+				if rr.Path != nil && rr.Path.ReplaceFullPath != nil {
+					uri = *rr.Path.ReplaceFullPath
+				}
+				actions = append(actions, map[string]interface{}{
+					"httpReply": true, "redirect": true,
+					"location": fmt.Sprintf("tcl:%s://%s:%s%s", scheme, hostname, port, uri),
+				})
+			}
+		}
+	}
+	for _, br := range rl.BackendRefs {
+		ns := hr.Namespace
+		if br.Namespace != nil {
+			ns = string(*br.Namespace)
+		}
+		// the routes with the refs not permitted are dispatched by the iRule, which
+		// answers 500, the policy has no such action. They are never forwarded.
+		if !ActiveSIGs.ReferenceGranted(hrKind(hr), hr.Namespace, "Service", utils.Keyname(ns, string(br.Name))) {
+			actions = []map[string]interface{}{{"forward": true, "reset": true}}
+			break
+		}
+		actions = append(actions, map[string]interface{}{
+			"forward": true, "select": true,
+			"pool": fmt.Sprintf("/%s/%s.%s", partition, ns, br.Name),
+		})
+	}
+
+	matchConditions := []map[string]interface{}{}
+	if b.match != nil {
+		matchConditions = policyMatchConditionsOf(b.match)
+	}
+	rules := []interface{}{}
+	for k, hcs := range hostConditions {
+		conditions := append(append([]map[string]interface{}{}, hcs...), matchConditions...)
+		rules = append(rules, map[string]interface{}{
+			"name":       fmt.Sprintf("%s-%d-%d-%d", hrName(hr), b.ruleIndex, b.matchIndex, k),
+			"conditions": namedPolicyItems(conditions),
+			"actions":    namedPolicyItems(actions),
+		})
+	}
+	return rules
+}
+
+// policyHostConditionsOf returns the alternative groups of host conditions.
+// The exact and the wildcard hostnames cannot be put into one condition.
+func policyHostConditionsOf(listenerHostname *gatewayv1beta1.Hostname, hostnames []gatewayv1beta1.Hostname) [][]map[string]interface{} {
+	hostCondition := func(hns []string) map[string]interface{} {
+		cond := map[string]interface{}{"httpHost": true, "host": true, "caseInsensitive": true, "equals": true}
+		values := []string{}
+		for _, hn := range hns {
+			if strings.HasPrefix(hn, "*.") {
+				delete(cond, "equals")
+				cond["endsWith"] = true
+				hn = strings.TrimPrefix(hn, "*")
+			}
+			values = append(values, hn)
+		}
+		cond["values"] = values
+		return cond
+	}
+
+	base := []map[string]interface{}{}
+	if listenerHostname != nil {
+		base = append(base, hostCondition([]string{string(*listenerHostname)}))
+	}
+	exacts, wildcards := []string{}, []string{}
+	for _, hn := range hostnames {
+		if strings.HasPrefix(string(hn), "*.") {
+			wildcards = append(wildcards, string(hn))
+		} else {
+			exacts = append(exacts, string(hn))
+		}
+	}
+
+	groups := [][]map[string]interface{}{}
+	for _, hns := range [][]string{exacts, wildcards} {
+		if len(hns) > 0 {
+			groups = append(groups, append(append([]map[string]interface{}{}, base...), hostCondition(hns)))
+		}
+	}
+	if len(groups) == 0 {
+		groups = append(groups, base)
+	}
+	return groups
+}
+
+func policyMatchConditionsOf(match *gatewayv1beta1.HTTPRouteMatch) []map[string]interface{} {
+	conditions := []map[string]interface{}{}
+	if match.Path != nil && match.Path.Value != nil {
+		cond := map[string]interface{}{"httpUri": true, "path": true, "startsWith": true, "values": []string{*match.Path.Value}}
+		if match.Path.Type != nil && *match.Path.Type == gatewayv1beta1.PathMatchExact {
+			delete(cond, "startsWith")
+			cond["equals"] = true
+		}
+		conditions = append(conditions, cond)
+	}
+	for _, header := range match.Headers {
+		conditions = append(conditions, map[string]interface{}{
+			"httpHeader": true, "tmName": string(header.Name), "equals": true, "values": []string{header.Value},
+		})
+	}
+	if match.Method != nil {
+		conditions = append(conditions, map[string]interface{}{
+			"httpMethod": true, "equals": true, "values": []string{string(*match.Method)},
+		})
+	}
+	for _, queryParam := range match.QueryParams {
+		conditions = append(conditions, map[string]interface{}{
+			"httpUri": true, "queryParameter": true, "tmName": queryParam.Name, "equals": true, "values": []string{queryParam.Value},
+		})
+	}
+	return conditions
+}
+
+// namedPolicyItems names the conditions or actions of a policy rule by their indexes.
+func namedPolicyItems(items []map[string]interface{}) []interface{} {
+	named := []interface{}{}
+	for i, item := range items {
+		// the items are shared by the rules, they are copied before named.
+		nitem := map[string]interface{}{"name": fmt.Sprintf("%d", i)}
+		for k, v := range item {
+			nitem[k] = v
+		}
+		named = append(named, nitem)
+	}
+	return named
+}
+
+// parseL4PoolsFrom returns the default pools of the TCP and UDP listeners of
+// gw, keyed by the virtual names, a route must have exactly one backendRef.
+func parseL4PoolsFrom(gw *gatewayv1beta1.Gateway, partition string) map[string]string {
+	pools := map[string]string{}
+	for vsname, route := range ActiveSIGs.L4RoutesOfListeners(gw) {
+		pools[vsname] = fmt.Sprintf("/%s/%s", partition, strings.Replace(route.svcKey, "/", ".", 1))
+	}
+	return pools
+}
+
+// sniListenerRule returns the rule of a TLS passthrough listener.
+// It collects the ClientHello, reads the server name into $sni for the
+// tlsroutes' rules, and rejects the connection if none of them picked a pool.
+func sniListenerRule(hostname *gatewayv1beta1.Hostname) string {
+	hostnameCheck := ""
+	if hostname != nil {
+		hostnameCheck = fmt.Sprintf(`
+			if { not [string match -nocase "%s" $sni] } {
+				reject
+				return
+			}
+		`, *hostname)
+	}
+	return fmt.Sprintf(`
+		when CLIENT_ACCEPTED {
+			TCP::collect
+		}
+		when CLIENT_DATA priority 100 {
+			set sni ""
+			binary scan [TCP::payload] cSSc rtype rversion rlength htype
+			if { $rtype == 22 && $htype == 1 } {
+				# record(5) + handshake header(4) + version(2) + random(32)
+				set offset 43
+				binary scan [TCP::payload] @${offset}c len
+				incr offset [expr {1 + ($len & 0xff)}]
+				binary scan [TCP::payload] @${offset}S len
+				incr offset [expr {2 + ($len & 0xffff)}]
+				binary scan [TCP::payload] @${offset}c len
+				incr offset [expr {1 + ($len & 0xff)}]
+				binary scan [TCP::payload] @${offset}S len
+				incr offset 2
+				set extend [expr {$offset + ($len & 0xffff)}]
+				while { $offset < $extend } {
+					binary scan [TCP::payload] @${offset}SS etype elen
+					incr offset 4
+					if { ($etype & 0xffff) == 0 } {
+						# server_name: list length(2) + name type(1) + name length(2) + name
+						binary scan [TCP::payload] @[expr {$offset + 3}]S len
+						binary scan [TCP::payload] @[expr {$offset + 5}]a[expr {$len & 0xffff}] sni
+						break
+					}
+					incr offset [expr {$elen & 0xffff}]
+				}
+			}
+			set sni [string tolower $sni]
+			%s
+		}
+		when CLIENT_DATA priority 900 {
+			if { not [info exists sni_pool] } {
+				reject
+				return
+			}
+			TCP::release
+		}
+	`, hostnameCheck)
+}
+
+// parseSNIRulesFrom creates the rule of the tlsroute, which picks the pool
+// by $sni set in the listener's rule, the traffic is not decrypted.
+func parseSNIRulesFrom(className string, tr *gatewayv1alpha2.TLSRoute, rlt map[string]interface{}) error {
+	name := trName(tr)
+	partition := ActiveSIGs.BackendPartitionOfClass(className)
+
+	hostnameConditions := []string{}
+	for _, hn := range tr.Spec.Hostnames {
+		hostnameConditions = append(hostnameConditions, fmt.Sprintf(`[string match -nocase "%s" $sni]`, hn))
+	}
+	hostnameCondition := strings.Join(hostnameConditions, " or ")
+	if hostnameCondition == "" {
+		hostnameCondition = "1 eq 1"
+	}
+
+	// all the backends of the rules are weighted together, as tlsroute rules have no matches.
+	poolWeights := []string{}
+	brErrs := []string{}
+	for _, rl := range tr.Spec.Rules {
+		for _, br := range rl.BackendRefs {
+			if (br.Group != nil && *br.Group != "") || (br.Kind != nil && *br.Kind != "Service") {
+				brErrs = append(brErrs, fmt.Sprintf("backendRef '%s' is not a Service", br.Name))
+				continue
+			}
+			ns := tr.Namespace
+			if br.Namespace != nil {
+				ns = string(*br.Namespace)
+			}
+			// the refs not permitted are reported in the ResolvedRefs condition.
+			if !ActiveSIGs.ReferenceGranted(reflect.TypeOf(*tr).Name(), tr.Namespace, "Service", utils.Keyname(ns, string(br.Name))) {
+				continue
+			}
+			pn := strings.Join([]string{ns, string(br.Name)}, ".")
+			pool := fmt.Sprintf("/%s/%s", partition, pn)
+			weight := 1
+			if br.Weight != nil {
+				weight = int(*br.Weight)
+			}
+			poolWeights = append(poolWeights, fmt.Sprintf("%s %d", pool, weight))
+		}
+	}
+
+	named := strings.ReplaceAll(strings.ReplaceAll(name, ".", "_"), "-", "_")
+	rlt["ltm/rule/"+name] = map[string]interface{}{
+		"name": name,
+		"apiAnonymous": fmt.Sprintf(`
+		when RULE_INIT {
+			array unset weights *
+			array unset static::pools_%s *
+			set index 0
+
+			array set weights { %s }
+			foreach name [array names weights] {
+				for { set i 0 }  { $i < $weights($name) }  { incr i } {
+					set static::pools_%s($index) $name
+					incr index
+				}
+			}
+			set static::pools_%s_size [array size static::pools_%s]
+		}
+		when CLIENT_DATA {
+			if { [info exists sni_pool] || $static::pools_%s_size == 0 } {
+				return
+			}
+			if { %s } {
+				set sni_pool $static::pools_%s([expr {int(rand()*$static::pools_%s_size)}])
+				pool $sni_pool
+			}
+		}
+	`, named, strings.Join(poolWeights, " "), named, named, named, named, hostnameCondition, named, named),
+	}
+	if len(brErrs) > 0 {
+		return fmt.Errorf("invalid backendRefs skipped: %s", strings.Join(brErrs, "; "))
+	}
 	return nil
 }
 
+// parsePathModifier returns the action rewriting the path, the query is kept.
+// ReplacePrefixMatch replaces the PathPrefix of the matches which the request hits.
+func parsePathModifier(pm *gatewayv1beta1.HTTPPathModifier, matches []gatewayv1beta1.HTTPRouteMatch) (string, error) {
+	switch pm.Type {
+	case gatewayv1beta1.FullPathHTTPPathModifier:
+		if pm.ReplaceFullPath == nil {
+			return "", fmt.Errorf("replaceFullPath must be set for %s", pm.Type)
+		}
+		return fmt.Sprintf(`HTTP::path "%s"`, *pm.ReplaceFullPath), nil
+	case gatewayv1beta1.PrefixMatchHTTPPathModifier:
+		if pm.ReplacePrefixMatch == nil {
+			return "", fmt.Errorf("replacePrefixMatch must be set for %s", pm.Type)
+		}
+		prefixes := []string{}
+		for _, match := range matches {
+			if match.Path != nil && match.Path.Value != nil &&
+				(match.Path.Type == nil || *match.Path.Type == gatewayv1beta1.PathMatchPathPrefix) {
+				prefixes = append(prefixes, fmt.Sprintf(`"%s"`, *match.Path.Value))
+			}
+		}
+		if len(prefixes) == 0 {
+			return "", fmt.Errorf("%s requires a PathPrefix match in the rule", pm.Type)
+		}
+		return fmt.Sprintf(`
+			set rpath [HTTP::path]
+			set rprefix "%s"
+			foreach prefix { %s } {
+				if { $rpath starts_with $prefix } {
+					set rest [string range $rpath [string length [string trimright $prefix "/"]] end]
+					if { [string index $rprefix end] eq "/" && [string index $rest 0] eq "/" } {
+						set rest [string range $rest 1 end]
+					}
+					HTTP::path "$rprefix$rest"
+					break
+				}
+			}
+		`, *pm.ReplacePrefixMatch, strings.Join(prefixes, " ")), nil
+	default:
+		return "", fmt.Errorf("unsupported path modifier type: %s", pm.Type)
+	}
+}
+
 func parseNeighsFrom(routerName, localAs, remoteAs string, addresses []string) (map[string]interface{}, error) {
 	rlt := map[string]interface{}{}
 
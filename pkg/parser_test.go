@@ -0,0 +1,70 @@
+package pkg
+
+import (
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+)
+
+func TestBackendRefsNotPermitted(t *testing.T) {
+	routeTo := func(ns string) *gatewayv1beta1.HTTPRoute {
+		bns := gatewayv1beta1.Namespace(ns)
+		port := gatewayv1beta1.PortNumber(80)
+		return &gatewayv1beta1.HTTPRoute{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "hr"},
+			Spec: gatewayv1beta1.HTTPRouteSpec{
+				Rules: []gatewayv1beta1.HTTPRouteRule{{
+					BackendRefs: []gatewayv1beta1.HTTPBackendRef{{
+						BackendRef: gatewayv1beta1.BackendRef{
+							BackendObjectReference: gatewayv1beta1.BackendObjectReference{
+								Name: "svc", Namespace: &bns, Port: &port,
+							},
+						},
+					}},
+				}},
+			},
+		}
+	}
+	listener := &gatewayv1beta1.Listener{Name: "http", Port: 80, Protocol: gatewayv1beta1.HTTPProtocolType}
+
+	cases := []struct {
+		name      string
+		hr        *gatewayv1beta1.HTTPRoute
+		permitted bool
+	}{
+		{name: "same namespace", hr: routeTo("default"), permitted: true},
+		{name: "other namespace without referencegrant", hr: routeTo("other"), permitted: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if policyExpressible(c.hr) != c.permitted {
+				t.Errorf("policyExpressible: expected %t", c.permitted)
+			}
+
+			ruleActions, _ := parseiRuleActionsFrom("p", c.hr)
+			if ruleActions[0] == nil {
+				t.Fatalf("iRule: the rule is left out")
+			}
+			if responded := strings.Contains(ruleActions[0].action, "HTTP::respond 500"); responded == c.permitted {
+				t.Errorf("iRule: expected responding 500 %t, got action %s", !c.permitted, ruleActions[0].action)
+			}
+
+			rules := parsePolicyRulesFrom(httpBranch{hr: c.hr}, listener, "p")
+			if len(rules) == 0 {
+				t.Fatalf("policy: the rule is left out")
+			}
+			for _, action := range rules[0].(map[string]interface{})["actions"].([]interface{}) {
+				action := action.(map[string]interface{})
+				if forwarded := action["select"] == true; forwarded != c.permitted {
+					t.Errorf("policy: expected forwarding %t, got action %v", c.permitted, action)
+				}
+				if reset := action["reset"] == true; reset == c.permitted {
+					t.Errorf("policy: expected resetting %t, got action %v", !c.permitted, action)
+				}
+			}
+		})
+	}
+}
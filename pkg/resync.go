@@ -0,0 +1,573 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	f5_bigip "gitee.com/zongzw/f5-bigip-rest/bigip"
+	"gitee.com/zongzw/f5-bigip-rest/utils"
+	"github.com/google/uuid"
+)
+
+// Resyncer compares the resources on the BIG-IPs with the desired state every
+// ResyncInterval, and repairs the drifted ones, which were modified or deleted
+// on the BIG-IP by hand. Each repaired resource is reported by the report func.
+func Resyncer(stopCh chan struct{}, bigips []*f5_bigip.BIGIP, report func(DriftReport)) {
+	if ResyncInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(ResyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			// the drifts are not known without all the resources synced.
+			if !ActiveSIGs.SyncedAtStart {
+				continue
+			}
+			for _, bigip := range bigips {
+				resyncBIGIP(bigip, report)
+			}
+		}
+	}
+}
+
+// resyncBIGIP checks the partitions managed on the BIG-IP one by one.
+func resyncBIGIP(bigip *f5_bigip.BIGIP, report func(DriftReport)) {
+	ctx := context.WithValue(context.TODO(), utils.CtxKey_Logger, utils.NewLog(uuid.New().String(), "info"))
+	slog := utils.LogFromContext(ctx)
+	bc := &f5_bigip.BIGIPContext{BIGIP: *bigip, Context: ctx}
+
+	partitions := append([]string{"Common"}, ActiveSIGs.ClassPartitions()...)
+	if pcfgs, err := ParseServicesRelatedForAll(); err != nil {
+		slog.Errorf("unable to parse the services for resync: %s", err.Error())
+	} else {
+		for partition := range pcfgs {
+			partitions = append(partitions, partition)
+		}
+	}
+
+	for _, partition := range partitions {
+		desired, err := desiredConfigsOf(partition, bigip.URL)
+		if err != nil {
+			slog.Errorf("unable to parse the desired state of %s for resync: %s", partition, err.Error())
+			continue
+		}
+		if desired == nil {
+			continue
+		}
+		from, to, drifts, err := driftsOf(bc, partition, desired)
+		if err != nil {
+			slog.Errorf("unable to check the drifts of %s on %s: %s", partition, bigip.URL, err.Error())
+			continue
+		}
+		DriftedResources.WithLabelValues(bigip.URL, partition).Set(float64(len(drifts)))
+		if len(drifts) == 0 {
+			continue
+		}
+
+		slog.Infof("found %d drifted resources in %s on %s, repairing", len(drifts), partition, bigip.URL)
+		PendingDeploys <- DeployRequest{
+			Meta:      fmt.Sprintf("repairing %d drifted resources in %s", len(drifts), partition),
+			From:      &from,
+			To:        &to,
+			Partition: partition,
+			StatusFunc: func(err error) {
+				for _, d := range drifts {
+					d.Err = err
+					report(d)
+				}
+			},
+			Context: context.WithValue(ctx, CtxKey_SpecifiedBIGIP, bigip.URL),
+		}
+	}
+}
+
+// driftsOf returns the configs to repair the drifted resources of the partition:
+// from is the actual state on the BIG-IP and to is the desired one.
+func driftsOf(bc *f5_bigip.BIGIPContext, partition string, desired *map[string]interface{}) (
+	map[string]interface{}, map[string]interface{}, []DriftReport, error) {
+
+	kinds, seen := []string{}, map[string]bool{}
+	for _, resources := range *desired {
+		for key := range resources.(map[string]interface{}) {
+			kind := key[:strings.LastIndex(key, "/")]
+			// uploaded files are not readable back.
+			if strings.HasPrefix(key, "shared/") || seen[kind] {
+				continue
+			}
+			seen[kind] = true
+			kinds = append(kinds, kind)
+		}
+	}
+	live, err := resourcesOn(bc, partition, kinds)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	from, to, drifts := map[string]interface{}{}, map[string]interface{}{}, []DriftReport{}
+	for folder, resources := range *desired {
+		for key, res := range resources.(map[string]interface{}) {
+			if strings.HasPrefix(key, "shared/") {
+				continue
+			}
+			i := strings.LastIndex(key, "/")
+			kind, name := key[:i], key[i+1:]
+
+			var actual *map[string]interface{}
+			lresources, _ := live[folder].(map[string]interface{})
+			if lres, ok := lresources[key].(map[string]interface{}); ok {
+				actual = &lres
+			}
+			reason := ""
+			if actual == nil {
+				reason = "deleted"
+			} else if field := modifiedFieldOf(res.(map[string]interface{}), *actual); field != "" {
+				reason = fmt.Sprintf("modified at %s", field)
+			} else {
+				continue
+			}
+
+			if _, ok := to[folder]; !ok {
+				from[folder], to[folder] = map[string]interface{}{}, map[string]interface{}{}
+			}
+			if actual != nil {
+				from[folder].(map[string]interface{})[key] = *actual
+			}
+			to[folder].(map[string]interface{})[key] = res
+			drifts = append(drifts, DriftReport{
+				BIGIP:     bc.URL,
+				Partition: partition,
+				Folder:    folder,
+				Kind:      kind,
+				Name:      name,
+				Reason:    reason,
+			})
+		}
+	}
+	return from, to, drifts, nil
+}
+
+// modifiedFieldOf returns the first field of the desired resource different
+// from the actual one, or "". The referred names are compared without their
+// partition paths, which are added by the BIG-IP. The lists of the nested
+// resources, like pool members or virtual profiles, are compared by the names
+// of the items, and the scalar fields of the items of the same names.
+func modifiedFieldOf(desired, actual map[string]interface{}) string {
+	// the desired resource has the typed lists and maps, like []string.
+	if bs, err := json.Marshal(desired); err == nil {
+		generic := map[string]interface{}{}
+		if json.Unmarshal(bs, &generic) == nil {
+			desired = generic
+		}
+	}
+	return modifiedFieldIn(desired, actual, true)
+}
+
+// modifiedFieldIn compares the fields of the desired resource, and the nested
+// ones as well if nested is true.
+func modifiedFieldIn(desired, actual map[string]interface{}, nested bool) string {
+	for k, v := range desired {
+		if k == "name" || k == "partition" || writeOnlyFields[k] {
+			continue
+		}
+		switch dv := v.(type) {
+		case []interface{}:
+			if !nested {
+				continue
+			}
+			if !sameItems(dv, nestedItemsOf(actual, k)) {
+				return k
+			}
+		case map[string]interface{}:
+			if !nested {
+				continue
+			}
+			av, _ := actual[k].(map[string]interface{})
+			if field := modifiedFieldIn(dv, av, false); field != "" {
+				return k + "." + field
+			}
+		default:
+			a, ok := actual[k]
+			if !ok {
+				return k
+			}
+			if normalizedValue(v) != normalizedValue(a) {
+				return k
+			}
+		}
+	}
+	return ""
+}
+
+// nestedItemsOf returns the items of the nested field of the actual resource,
+// which are returned by the BIG-IP either in the field itself or in the items
+// of its subcollection reference, like membersReference of the pool.
+func nestedItemsOf(actual map[string]interface{}, field string) []interface{} {
+	if items, ok := actual[field].([]interface{}); ok {
+		return items
+	}
+	if ref, ok := actual[field+"Reference"].(map[string]interface{}); ok {
+		if items, ok := ref["items"].([]interface{}); ok {
+			return items
+		}
+	}
+	// the empty lists are left out by the BIG-IP.
+	return []interface{}{}
+}
+
+// sameItems checks the desired items are the actual ones. The items are the
+// names, or the objects identified by their names.
+func sameItems(desired, actual []interface{}) bool {
+	if len(desired) != len(actual) {
+		return false
+	}
+	actuals := map[string]interface{}{}
+	for _, a := range actual {
+		actuals[normalizedName(itemNameOf(a))] = a
+	}
+	for _, d := range desired {
+		a, ok := actuals[normalizedName(itemNameOf(d))]
+		if !ok {
+			return false
+		}
+		dm, dok := d.(map[string]interface{})
+		am, aok := a.(map[string]interface{})
+		if dok && aok && modifiedFieldIn(dm, am, false) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func itemNameOf(item interface{}) string {
+	if m, ok := item.(map[string]interface{}); ok {
+		return fmt.Sprintf("%v", m["name"])
+	}
+	return fmt.Sprintf("%v", item)
+}
+
+// normalizedName returns the name without the partition and folder path,
+// e.g. "/Common/http" is "http".
+func normalizedName(name string) string {
+	return name[strings.LastIndex(name, "/")+1:]
+}
+
+// normalizedValue returns the scalar value to be compared. The BIG-IP returns
+// the referred names with their partition paths, like "/Common/tcp" for "tcp",
+// and the monitor expressions in braces, like "min 1 of { /Common/tcp }" for
+// "min 1 of tcp". The multi-line values, like the iRule bodies, are trimmed only.
+func normalizedValue(v interface{}) string {
+	s := strings.TrimSpace(fmt.Sprintf("%v", v))
+	if strings.Contains(s, "\n") {
+		return s
+	}
+	tokens := []string{}
+	for _, token := range strings.Fields(s) {
+		if token == "{" || token == "}" {
+			continue
+		}
+		tokens = append(tokens, normalizedName(token))
+	}
+	return strings.Join(tokens, " ")
+}
+
+// ReconcileAtStart makes the partitions on the BIG-IPs match the desired state
+// parsed from the synced cache: the missing resources are created, and the
+// orphaned ones, left by the objects deleted while the controller was down,
+// are deleted if ReconcileDeleteOrphans, or logged only. Only the resources of
+// OwnedKinds named by the controller are deleted, and only the partitions
+// created by the controller. The net resources in Common are replaced instead.
+func ReconcileAtStart(bigips []*f5_bigip.BIGIP) {
+	defer utils.TimeItToPrometheus()()
+
+	ctx := context.WithValue(context.TODO(), utils.CtxKey_Logger, utils.NewLog(uuid.New().String(), "info"))
+	slog := utils.LogFromContext(ctx)
+
+	partitions := append(ActiveSIGs.ClassPartitions(), ActiveSIGs.BackendPartitions()...)
+	for _, bigip := range bigips {
+		bc := &f5_bigip.BIGIPContext{BIGIP: *bigip, Context: ctx}
+
+		if err := reconcileCommon(bc); err != nil {
+			slog.Errorf("unable to reconcile Common on %s at startup: %s", bigip.URL, err.Error())
+		}
+		done := map[string]bool{}
+		for _, partition := range partitions {
+			if done[partition] || partition == "Common" {
+				continue
+			}
+			done[partition] = true
+			if err := reconcilePartition(bc, partition); err != nil {
+				slog.Errorf("unable to reconcile %s on %s at startup: %s", partition, bigip.URL, err.Error())
+			}
+		}
+		if err := deleteUnusedPartitions(bc, done); err != nil {
+			slog.Errorf("unable to delete the unused partitions on %s at startup: %s", bigip.URL, err.Error())
+		}
+	}
+}
+
+// deleteUnusedPartitions deletes the partitions created by the controller on
+// the BIG-IP, which are no longer the partitions of classes or backends, like
+// the ones of the classes deleted while the controller was down. The BIG-IP
+// refuses to delete the partitions with the resources not created by the
+// controller left.
+func deleteUnusedPartitions(bc *f5_bigip.BIGIPContext, used map[string]bool) error {
+	slog := utils.LogFromContext(bc.Context)
+
+	partitions, err := partitionsOn(bc)
+	if err != nil {
+		return err
+	}
+	for partition, description := range partitions {
+		if used[partition] || partition == "Common" || description != ownedPartitionDescription() {
+			continue
+		}
+		if !ReconcileDeleteOrphans {
+			slog.Infof("found unused partition %s on %s at startup, not deleted without --reconcile-delete-orphans",
+				partition, bc.URL)
+			continue
+		}
+		live, err := resourcesOn(bc, partition, OwnedKinds)
+		if err != nil {
+			return err
+		}
+		slog.Infof("deleting unused partition %s on %s at startup", partition, bc.URL)
+		partition := partition
+		ctx := context.WithValue(bc.Context, CtxKey_SpecifiedBIGIP, bc.URL)
+		PendingDeploys <- DeployRequest{
+			Meta:      fmt.Sprintf("deleting unused partition %s at startup", partition),
+			From:      &live,
+			To:        nil,
+			Partition: partition,
+			StatusFunc: func(err error) {
+				if err != nil {
+					slog.Errorf("failed to delete unused partition %s on %s at startup: %s", partition, bc.URL, err.Error())
+				} else {
+					slog.Infof("deleted unused partition %s on %s at startup", partition, bc.URL)
+				}
+			},
+			Context: context.WithValue(ctx, CtxKey_DeletePartition, "yes"),
+		}
+	}
+	return nil
+}
+
+// reconcileCommon replaces the net resources in Common with the desired ones,
+// which removes the bgp neighbors and fdb records of the deleted nodes.
+func reconcileCommon(bc *f5_bigip.BIGIPContext) error {
+	desired, err := desiredConfigsOf("Common", bc.URL)
+	if err != nil {
+		return err
+	}
+	from := map[string]interface{}{}
+	for folder, resources := range *desired {
+		from[folder] = map[string]interface{}{}
+		for key := range resources.(map[string]interface{}) {
+			i := strings.LastIndex(key, "/")
+			actual, err := bc.Exist(key[:i], key[i+1:], "Common", folder)
+			if err != nil {
+				return err
+			}
+			if actual != nil {
+				from[folder].(map[string]interface{})[key] = *actual
+			}
+		}
+	}
+	reconcileDeploy(bc, "Common", from, *desired)
+	return nil
+}
+
+// reconcilePartition diffs the resources of OwnedKinds named by the controller
+// in the partition with the desired ones, the existing ones are left to the
+// resync. The desired resources of the other kinds, like the nodes and the ssl
+// files, are checked one by one and never deleted.
+func reconcilePartition(bc *f5_bigip.BIGIPContext, partition string) error {
+	slog := utils.LogFromContext(bc.Context)
+
+	desired, err := desiredConfigsOf(partition, bc.URL)
+	if err != nil {
+		return err
+	}
+	to := map[string]interface{}{"": map[string]interface{}{}}
+	if desired != nil {
+		to = *desired
+	}
+
+	live, err := resourcesOn(bc, partition, OwnedKinds)
+	if err != nil {
+		return err
+	}
+
+	from, orphans, missings := map[string]interface{}{}, 0, 0
+	for folder, resources := range live {
+		from[folder] = map[string]interface{}{}
+		if _, ok := to[folder]; !ok {
+			to[folder] = map[string]interface{}{}
+		}
+		for key, res := range resources.(map[string]interface{}) {
+			if dres, ok := to[folder].(map[string]interface{})[key]; ok {
+				from[folder].(map[string]interface{})[key] = dres
+				continue
+			}
+			i := strings.LastIndex(key, "/")
+			if !namedByController(key[:i], key[i+1:]) {
+				continue
+			}
+			if !ReconcileDeleteOrphans {
+				slog.Infof("found orphaned %s in %s on %s at startup, not deleted without --reconcile-delete-orphans",
+					key, partition, bc.URL)
+				continue
+			}
+			from[folder].(map[string]interface{})[key] = res
+			orphans++
+		}
+	}
+	ownedKinds := map[string]bool{}
+	for _, kind := range OwnedKinds {
+		ownedKinds[kind] = true
+	}
+	for folder, resources := range to {
+		if _, ok := from[folder]; !ok {
+			from[folder] = map[string]interface{}{}
+		}
+		for key, res := range resources.(map[string]interface{}) {
+			i := strings.LastIndex(key, "/")
+			if strings.HasPrefix(key, "shared/") || ownedKinds[key[:i]] {
+				continue
+			}
+			actual, err := bc.Exist(key[:i], key[i+1:], partition, folder)
+			if err != nil {
+				return err
+			}
+			if actual != nil {
+				from[folder].(map[string]interface{})[key] = res
+			}
+		}
+	}
+	for folder, resources := range to {
+		for key, res := range resources.(map[string]interface{}) {
+			if _, ok := from[folder].(map[string]interface{})[key]; ok {
+				continue
+			}
+			// the uploaded file is left out with its existing ssl file.
+			if strings.HasPrefix(key, "shared/file-transfer/uploads/") {
+				filename := strings.TrimPrefix(key, "shared/file-transfer/uploads/")
+				fresources := from[folder].(map[string]interface{})
+				if fresources["sys/file/ssl-cert/"+filename] != nil || fresources["sys/file/ssl-key/"+filename] != nil {
+					fresources[key] = res
+					continue
+				}
+			}
+			missings++
+		}
+	}
+
+	if orphans == 0 && missings == 0 {
+		return nil
+	}
+	slog.Infof("reconciling %s on %s at startup: %d orphaned, %d missing", partition, bc.URL, orphans, missings)
+	reconcileDeploy(bc, partition, from, to)
+	return nil
+}
+
+func reconcileDeploy(bc *f5_bigip.BIGIPContext, partition string, from, to map[string]interface{}) {
+	slog := utils.LogFromContext(bc.Context)
+
+	ctx := context.WithValue(bc.Context, CtxKey_SpecifiedBIGIP, bc.URL)
+	if partition != "Common" {
+		ctx = context.WithValue(ctx, CtxKey_CreatePartition, "yes")
+	}
+	PendingDeploys <- DeployRequest{
+		Meta:      fmt.Sprintf("reconciling %s at startup", partition),
+		From:      &from,
+		To:        &to,
+		Partition: partition,
+		StatusFunc: func(err error) {
+			if err != nil {
+				slog.Errorf("failed to reconcile %s on %s at startup: %s", partition, bc.URL, err.Error())
+			} else {
+				slog.Infof("reconciled %s on %s at startup", partition, bc.URL)
+			}
+		},
+		Context: ctx,
+	}
+}
+
+// resourcesOn returns the resources of the kinds in the partition on the
+// BIG-IP, in the same format as the parsed configs. Each kind is listed once,
+// with the subcollections, like the pool members, expanded.
+func resourcesOn(bc *f5_bigip.BIGIPContext, partition string, kinds []string) (map[string]interface{}, error) {
+	rlt := map[string]interface{}{}
+	for _, kind := range kinds {
+		all, err := bc.All(kind + "?expandSubcollections=true")
+		if err != nil {
+			return nil, err
+		}
+		if all == nil {
+			continue
+		}
+		items, _ := (*all)["items"].([]interface{})
+		for _, item := range items {
+			res, ok := item.(map[string]interface{})
+			if !ok || res["partition"] != partition {
+				continue
+			}
+			folder, _ := res["subPath"].(string)
+			if _, ok := rlt[folder]; !ok {
+				rlt[folder] = map[string]interface{}{}
+			}
+			rlt[folder].(map[string]interface{})[fmt.Sprintf("%s/%s", kind, res["name"])] = res
+		}
+	}
+	return rlt, nil
+}
+
+// namedByController tells whether the resource of OwnedKinds is named the way
+// the controller names it, so that the ones of other tenants sharing the
+// partition, like the default backend partition, are never deleted: the ones
+// of gateways are named gw.<namespace>.<name>..., and the pools, monitors and
+// server-ssl profiles of services are named <namespace>.<name>.
+func namedByController(kind, name string) bool {
+	if strings.HasPrefix(name, "gw.") {
+		return true
+	}
+	switch {
+	case kind == "ltm/pool", kind == "ltm/profile/server-ssl", strings.HasPrefix(kind, "ltm/monitor/"):
+		return serviceResourceName.MatchString(name)
+	default:
+		return false
+	}
+}
+
+// partitionsOn returns the descriptions of the partitions on the BIG-IP.
+func partitionsOn(bc *f5_bigip.BIGIPContext) (map[string]string, error) {
+	all, err := bc.All("auth/partition")
+	if err != nil {
+		return nil, err
+	}
+	rlt := map[string]string{}
+	if all == nil {
+		return rlt, nil
+	}
+	items, _ := (*all)["items"].([]interface{})
+	for _, item := range items {
+		if p, ok := item.(map[string]interface{}); ok {
+			description, _ := p["description"].(string)
+			rlt[fmt.Sprintf("%v", p["name"])] = description
+		}
+	}
+	return rlt, nil
+}
+
+// ownedPartitionDescription is the description of the partitions created by
+// the controller, by which the unused ones are found at startup.
+func ownedPartitionDescription() string {
+	return fmt.Sprintf("managed by %s", ActiveSIGs.ControllerName)
+}
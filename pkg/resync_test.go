@@ -0,0 +1,287 @@
+package pkg
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestModifiedFieldOf(t *testing.T) {
+	actualOf := func(body string) map[string]interface{} {
+		actual := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(body), &actual); err != nil {
+			t.Fatalf("invalid actual: %s", err.Error())
+		}
+		return actual
+	}
+
+	pool := map[string]interface{}{
+		"name":    "ns.svc",
+		"monitor": "/p/ns.svc",
+		"members": []interface{}{
+			map[string]interface{}{"name": "10.250.1.1:80", "address": "10.250.1.1"},
+			map[string]interface{}{"name": "10.250.1.2:80", "address": "10.250.1.2"},
+		},
+	}
+	poolBody := `{
+		"kind": "tm:ltm:pool:poolstate",
+		"name": "ns.svc",
+		"partition": "p",
+		"fullPath": "/p/ns.svc",
+		"generation": 245,
+		"selfLink": "https://localhost/mgmt/tm/ltm/pool/~p~ns.svc?ver=16.1.0",
+		"loadBalancingMode": "round-robin",
+		"monitor": "/p/ns.svc ",
+		"membersReference": {
+			"link": "https://localhost/mgmt/tm/ltm/pool/~p~ns.svc/members?ver=16.1.0",
+			"isSubcollection": true,
+			"items": [
+				{
+					"kind": "tm:ltm:pool:members:membersstate",
+					"name": "10.250.1.1:80",
+					"partition": "p",
+					"fullPath": "/p/10.250.1.1:80",
+					"address": "10.250.1.1",
+					"ratio": 1,
+					"state": "up"
+				},
+				{
+					"kind": "tm:ltm:pool:members:membersstate",
+					"name": "10.250.1.2:80",
+					"partition": "p",
+					"fullPath": "/p/10.250.1.2:80",
+					"address": "10.250.1.2",
+					"ratio": 1,
+					"state": "up"
+				}
+			]
+		}
+	}`
+
+	virtual := map[string]interface{}{
+		"name":        "gw.ns.gw.http",
+		"ipProtocol":  "tcp",
+		"destination": "10.250.15.180:80",
+		"sourceAddressTranslation": map[string]interface{}{
+			"type": "snat", "pool": "gw.ns.gw",
+		},
+		"profiles": []interface{}{
+			map[string]string{"name": "/Common/http"},
+			map[string]string{"name": "/Common/tcp"},
+		},
+		"rules":    []string{"gw.ns.gw.http"},
+		"policies": []interface{}{},
+		"persist": []interface{}{
+			map[string]interface{}{"name": "/Common/cookie", "tmDefault": "yes"},
+		},
+	}
+	virtualBody := `{
+		"kind": "tm:ltm:virtual:virtualstate",
+		"name": "gw.ns.gw.http",
+		"partition": "p",
+		"fullPath": "/p/gw.ns.gw.http",
+		"destination": "/p/10.250.15.180:80",
+		"ipProtocol": "tcp",
+		"mask": "255.255.255.255",
+		"rules": ["/p/gw.ns.gw.http"],
+		"sourceAddressTranslation": {"type": "snat", "pool": "/p/gw.ns.gw"},
+		"persist": [
+			{
+				"name": "cookie",
+				"partition": "Common",
+				"tmDefault": "yes",
+				"nameReference": {"link": "https://localhost/mgmt/tm/ltm/persistence/cookie/~Common~cookie?ver=16.1.0"}
+			}
+		],
+		"policiesReference": {
+			"link": "https://localhost/mgmt/tm/ltm/virtual/~p~gw.ns.gw.http/policies?ver=16.1.0",
+			"isSubcollection": true
+		},
+		"profilesReference": {
+			"link": "https://localhost/mgmt/tm/ltm/virtual/~p~gw.ns.gw.http/profiles?ver=16.1.0",
+			"isSubcollection": true,
+			"items": [
+				{"kind": "tm:ltm:virtual:profiles:profilesstate", "name": "http", "partition": "Common", "fullPath": "/Common/http", "context": "all"},
+				{"kind": "tm:ltm:virtual:profiles:profilesstate", "name": "tcp", "partition": "Common", "fullPath": "/Common/tcp", "context": "all"}
+			]
+		}
+	}`
+
+	policy := map[string]interface{}{
+		"name":     "gw.ns.gw.http",
+		"legacy":   true,
+		"strategy": "/Common/first-match",
+		"requires": []string{"http"},
+		"controls": []string{"forwarding"},
+		"rules": []interface{}{
+			map[string]interface{}{"name": "hr.ns.hr-0-0-0", "ordinal": 0, "conditions": []interface{}{}, "actions": []interface{}{}},
+		},
+	}
+	policyBody := `{
+		"kind": "tm:ltm:policy:policystate",
+		"name": "gw.ns.gw.http",
+		"partition": "p",
+		"fullPath": "/p/gw.ns.gw.http",
+		"controls": ["forwarding"],
+		"requires": ["http"],
+		"status": "legacy",
+		"strategy": "/Common/first-match",
+		"rulesReference": {
+			"link": "https://localhost/mgmt/tm/ltm/policy/~p~gw.ns.gw.http/rules?ver=16.1.0",
+			"isSubcollection": true,
+			"items": [
+				{
+					"kind": "tm:ltm:policy:rules:rulesstate",
+					"name": "hr.ns.hr-0-0-0",
+					"fullPath": "hr.ns.hr-0-0-0",
+					"ordinal": 0,
+					"actionsReference": {"link": "https://localhost/mgmt/tm/ltm/policy/~p~gw.ns.gw.http/rules/hr.ns.hr-0-0-0/actions?ver=16.1.0", "isSubcollection": true},
+					"conditionsReference": {"link": "https://localhost/mgmt/tm/ltm/policy/~p~gw.ns.gw.http/rules/hr.ns.hr-0-0-0/conditions?ver=16.1.0", "isSubcollection": true}
+				}
+			]
+		}
+	}`
+
+	rule := map[string]interface{}{
+		"name":         "gw.ns.gw.http",
+		"apiAnonymous": "\nwhen HTTP_REQUEST {\n    pool /p/ns.svc\n}\n",
+	}
+	ruleBody := `{
+		"kind": "tm:ltm:rule:rulestate",
+		"name": "gw.ns.gw.http",
+		"partition": "p",
+		"fullPath": "/p/gw.ns.gw.http",
+		"apiAnonymous": "when HTTP_REQUEST {\n    pool /p/ns.svc\n}"
+	}`
+
+	defaultPool := map[string]interface{}{
+		"name":    "ns.svc",
+		"monitor": "min 1 of tcp",
+		"members": []interface{}{},
+	}
+	defaultPoolBody := `{
+		"kind": "tm:ltm:pool:poolstate",
+		"name": "ns.svc",
+		"partition": "p",
+		"fullPath": "/p/ns.svc",
+		"monitor": "min 1 of { /Common/tcp }",
+		"membersReference": {
+			"link": "https://localhost/mgmt/tm/ltm/pool/~p~ns.svc/members?ver=16.1.0",
+			"isSubcollection": true
+		}
+	}`
+
+	cert := map[string]interface{}{
+		"name":       "scrt.ns.n.0a1b2c3d.crt",
+		"sourcePath": "file:/var/config/rest/downloads/scrt.ns.n.0a1b2c3d.crt",
+	}
+	certBody := `{
+		"kind": "tm:sys:file:ssl-cert:ssl-certstate",
+		"name": "scrt.ns.n.0a1b2c3d.crt",
+		"partition": "p",
+		"fullPath": "/p/scrt.ns.n.0a1b2c3d.crt",
+		"certificateKeyCurveName": "none",
+		"certificateKeySize": 2048,
+		"checksum": "SHA1:1204:9d2fb7a0e5c1e96ef0df8bd2c24e9e3e4a0b8f2a",
+		"createTime": "2023-01-05T08:12:36Z",
+		"expirationString": "Jan  5 08:12:36 2024 GMT",
+		"issuer": "CN=gateway.test.com",
+		"keyType": "rsa-private",
+		"subject": "CN=gateway.test.com"
+	}`
+
+	cases := []struct {
+		name     string
+		desired  map[string]interface{}
+		actual   string
+		modified string
+	}{
+		{name: "pool in sync", desired: pool, actual: poolBody, modified: ""},
+		{name: "virtual in sync", desired: virtual, actual: virtualBody, modified: ""},
+		{
+			name:     "pool member replaced",
+			desired:  pool,
+			actual:   strings.Replace(poolBody, `"name": "10.250.1.2:80"`, `"name": "10.250.1.3:80"`, 1),
+			modified: "members",
+		},
+		{
+			name:     "pool member address modified",
+			desired:  pool,
+			actual:   strings.Replace(poolBody, `"address": "10.250.1.2"`, `"address": "10.250.1.3"`, 1),
+			modified: "members",
+		},
+		{
+			name:     "pool monitor modified",
+			desired:  pool,
+			actual:   strings.Replace(poolBody, `"monitor": "/p/ns.svc "`, `"monitor": "/Common/tcp "`, 1),
+			modified: "monitor",
+		},
+		{
+			name:     "virtual irule detached",
+			desired:  virtual,
+			actual:   strings.Replace(virtualBody, `"rules": ["/p/gw.ns.gw.http"],`, "", 1),
+			modified: "rules",
+		},
+		{
+			name:     "virtual profile without full path",
+			desired:  virtual,
+			actual:   strings.Replace(virtualBody, `"fullPath": "/Common/http", `, "", 1),
+			modified: "",
+		},
+		{
+			name:     "virtual profile replaced",
+			desired:  virtual,
+			actual:   strings.Replace(virtualBody, `"name": "tcp", "partition": "Common"`, `"name": "fastL4", "partition": "Common"`, 1),
+			modified: "profiles",
+		},
+		{
+			name:    "virtual policy attached",
+			desired: virtual,
+			actual: strings.Replace(virtualBody, `"isSubcollection": true
+		},`, `"isSubcollection": true, "items": [{"name": "other", "partition": "Common"}]},`, 1),
+			modified: "policies",
+		},
+		{
+			name:     "virtual persistence modified",
+			desired:  virtual,
+			actual:   strings.Replace(virtualBody, `"tmDefault": "yes"`, `"tmDefault": "no"`, 1),
+			modified: "persist",
+		},
+		{
+			name:     "virtual snat pool modified",
+			desired:  virtual,
+			actual:   strings.Replace(virtualBody, `"pool": "/p/gw.ns.gw"`, `"pool": "/p/other"`, 1),
+			modified: "sourceAddressTranslation.pool",
+		},
+		{name: "policy in sync", desired: policy, actual: policyBody, modified: ""},
+		{name: "irule in sync", desired: rule, actual: ruleBody, modified: ""},
+		{
+			name:     "irule modified",
+			desired:  rule,
+			actual:   strings.Replace(ruleBody, `pool /p/ns.svc`, `pool /p/other`, 1),
+			modified: "apiAnonymous",
+		},
+		{name: "pool with the default monitor in sync", desired: defaultPool, actual: defaultPoolBody, modified: ""},
+		{
+			name:     "pool default monitor modified",
+			desired:  defaultPool,
+			actual:   strings.Replace(defaultPoolBody, `{ /Common/tcp }`, `{ /Common/http }`, 1),
+			modified: "monitor",
+		},
+		{name: "cert in sync", desired: cert, actual: certBody, modified: ""},
+		{
+			name:     "policy rule replaced",
+			desired:  policy,
+			actual:   strings.Replace(policyBody, `"name": "hr.ns.hr-0-0-0"`, `"name": "other"`, 1),
+			modified: "rules",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if modified := modifiedFieldOf(c.desired, actualOf(c.actual)); modified != c.modified {
+				t.Errorf("expected modified '%s', got '%s'", c.modified, modified)
+			}
+		})
+	}
+}
@@ -0,0 +1,602 @@
+package pkg
+
+import (
+	"fmt"
+	"reflect"
+
+	"gitee.com/zongzw/f5-bigip-rest/utils"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
+	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
+)
+
+// SetGatewayClassStatus marks the gatewayclass as accepted by this controller,
+// or not accepted if its parameters are invalid.
+func SetGatewayClassStatus(gwc *gatewayv1beta1.GatewayClass) {
+	accepted := metav1.Condition{
+		Type:               string(gatewayv1beta1.GatewayClassConditionStatusAccepted),
+		Status:             metav1.ConditionTrue,
+		Reason:             string(gatewayv1beta1.GatewayClassReasonAccepted),
+		Message:            "Accepted by " + ActiveSIGs.ControllerName,
+		ObservedGeneration: gwc.Generation,
+	}
+	if _, err := ActiveSIGs.ClassParametersOf(gwc); err != nil {
+		accepted.Status = metav1.ConditionFalse
+		accepted.Reason = string(gatewayv1beta1.GatewayClassReasonInvalidParameters)
+		accepted.Message = err.Error()
+	}
+	meta.SetStatusCondition(&gwc.Status.Conditions, accepted)
+}
+
+// SetGatewayStatus fills gw.Status with the conditions and listener states
+// calculated from the current cache. deployErr is the result of the
+// deployment of the gateway's partition.
+func (c *SIGCache) SetGatewayStatus(gw *gatewayv1beta1.Gateway, deployErr error) {
+	defer utils.TimeItToPrometheus()()
+
+	// parseGateway reads the cache by itself, so it's called before locking.
+	_, listenerErrs, parseErr := parseGateway(gw)
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	accepted := metav1.Condition{
+		Type:               GatewayConditionAccepted,
+		Status:             metav1.ConditionTrue,
+		Reason:             GatewayReasonAccepted,
+		Message:            "Accepted",
+		ObservedGeneration: gw.Generation,
+	}
+	for _, addr := range gw.Spec.Addresses {
+		if addr.Type != nil && *addr.Type != gatewayv1beta1.IPAddressType {
+			accepted.Status = metav1.ConditionFalse
+			accepted.Reason = string(gatewayv1beta1.GatewayReasonAddressNotAssigned)
+			accepted.Message = fmt.Sprintf("unsupported AddressType: %s", *addr.Type)
+		}
+	}
+	for _, listener := range gw.Spec.Listeners {
+		if !protocolSupported(listener.Protocol) {
+			accepted.Status = metav1.ConditionFalse
+			accepted.Reason = string(gatewayv1beta1.GatewayReasonListenersNotValid)
+			accepted.Message = fmt.Sprintf("unsupported ProtocolType: %s", listener.Protocol)
+		}
+	}
+	meta.SetStatusCondition(&gw.Status.Conditions, accepted)
+
+	programmed := metav1.Condition{
+		Type:               GatewayConditionProgrammed,
+		Status:             metav1.ConditionTrue,
+		Reason:             GatewayReasonProgrammed,
+		Message:            "Deployed to BIG-IP",
+		ObservedGeneration: gw.Generation,
+	}
+	if accepted.Status != metav1.ConditionTrue {
+		programmed.Status = metav1.ConditionFalse
+		programmed.Reason = GatewayReasonInvalid
+		programmed.Message = accepted.Message
+	} else if parseErr != nil {
+		programmed.Status = metav1.ConditionFalse
+		programmed.Reason = GatewayReasonInvalid
+		programmed.Message = parseErr.Error()
+	} else if deployErr != nil {
+		programmed.Status = metav1.ConditionFalse
+		programmed.Reason = GatewayReasonPending
+		programmed.Message = fmt.Sprintf("failed to deploy, will retry: %s", deployErr.Error())
+	}
+	meta.SetStatusCondition(&gw.Status.Conditions, programmed)
+
+	lss := []gatewayv1beta1.ListenerStatus{}
+	for i, listener := range gw.Spec.Listeners {
+		ls := gatewayv1beta1.ListenerStatus{
+			Name:           listener.Name,
+			SupportedKinds: supportedKindsOf(&gw.Spec.Listeners[i]),
+			AttachedRoutes: c._attachedRoutesCount(gw, &gw.Spec.Listeners[i]),
+			Conditions:     []metav1.Condition{},
+		}
+		for _, ols := range gw.Status.Listeners {
+			if ols.Name == listener.Name {
+				ls.Conditions = ols.Conditions
+			}
+		}
+
+		detached := metav1.Condition{
+			Type:               string(gatewayv1beta1.ListenerConditionDetached),
+			Status:             metav1.ConditionFalse,
+			Reason:             string(gatewayv1beta1.ListenerReasonAttached),
+			Message:            "Attached",
+			ObservedGeneration: gw.Generation,
+		}
+		if !protocolSupported(listener.Protocol) {
+			detached.Status = metav1.ConditionTrue
+			detached.Reason = string(gatewayv1beta1.ListenerReasonUnsupportedProtocol)
+			detached.Message = fmt.Sprintf("unsupported ProtocolType: %s", listener.Protocol)
+		}
+		meta.SetStatusCondition(&ls.Conditions, detached)
+
+		resolved := metav1.Condition{
+			Type:               string(gatewayv1beta1.ListenerConditionResolvedRefs),
+			Status:             metav1.ConditionTrue,
+			Reason:             string(gatewayv1beta1.ListenerReasonResolvedRefs),
+			Message:            "ResolvedRefs",
+			ObservedGeneration: gw.Generation,
+		}
+		if listener.AllowedRoutes != nil && len(listener.AllowedRoutes.Kinds) != len(ls.SupportedKinds) {
+			resolved.Status = metav1.ConditionFalse
+			resolved.Reason = string(gatewayv1beta1.ListenerReasonInvalidRouteKinds)
+			resolved.Message = "some of the allowedRoutes kinds are not supported"
+		}
+		for _, ref := range certificateRefsOf(&gw.Spec.Listeners[i]) {
+			ns := gw.Namespace
+			if ref.Namespace != nil {
+				ns = string(*ref.Namespace)
+			}
+			if !c._referenceGranted(reflect.TypeOf(*gw).Name(), gw.Namespace, "Secret", utils.Keyname(ns, string(ref.Name))) {
+				resolved.Status = metav1.ConditionFalse
+				resolved.Reason = string(gatewayv1beta1.ListenerReasonRefNotPermitted)
+				resolved.Message = fmt.Sprintf("secret %s is not permitted by any referencegrant", utils.Keyname(ns, string(ref.Name)))
+			} else if _, ok := c.Secret[utils.Keyname(ns, string(ref.Name))]; !ok {
+				resolved.Status = metav1.ConditionFalse
+				resolved.Reason = string(gatewayv1beta1.ListenerReasonInvalidCertificateRef)
+				resolved.Message = fmt.Sprintf("secret %s not found", utils.Keyname(ns, string(ref.Name)))
+			}
+		}
+		meta.SetStatusCondition(&ls.Conditions, resolved)
+
+		// the invalid listener is skipped, the others of the gateway are still deployed.
+		lprogrammed := metav1.Condition{
+			Type:               string(gatewayv1beta1.ListenerConditionProgrammed),
+			Status:             metav1.ConditionTrue,
+			Reason:             string(gatewayv1beta1.ListenerReasonProgrammed),
+			Message:            "Deployed to BIG-IP",
+			ObservedGeneration: gw.Generation,
+		}
+		if err := listenerErrs[string(listener.Name)]; err != nil {
+			lprogrammed.Status = metav1.ConditionFalse
+			lprogrammed.Reason = string(gatewayv1beta1.ListenerReasonInvalid)
+			lprogrammed.Message = err.Error()
+		} else if programmed.Status != metav1.ConditionTrue {
+			lprogrammed.Status = metav1.ConditionFalse
+			lprogrammed.Reason = string(gatewayv1beta1.ListenerReasonPending)
+			if programmed.Reason == GatewayReasonInvalid {
+				lprogrammed.Reason = string(gatewayv1beta1.ListenerReasonInvalid)
+			}
+			lprogrammed.Message = programmed.Message
+		}
+		meta.SetStatusCondition(&ls.Conditions, lprogrammed)
+
+		lss = append(lss, ls)
+	}
+	gw.Status.Listeners = lss
+}
+
+// SetHTTPRouteStatus refreshes the parents' status of hr that belong to this
+// controller. The parents handled by other controllers are kept as they are.
+func (c *SIGCache) SetHTTPRouteStatus(hr *gatewayv1beta1.HTTPRoute) {
+	defer utils.TimeItToPrometheus()()
+
+	// the skipped rules are reported in the Accepted condition.
+	_, parseErr := parseHTTPRoute("", hr)
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	parents := []gatewayv1beta1.RouteParentStatus{}
+	for _, ps := range hr.Status.Parents {
+		if ps.ControllerName != gatewayv1beta1.GatewayController(c.ControllerName) {
+			parents = append(parents, ps)
+		}
+	}
+
+	resolved := c._resolvedRefsCondition(hr)
+	for _, pr := range hr.Spec.ParentRefs {
+		ns := hr.Namespace
+		if pr.Namespace != nil {
+			ns = string(*pr.Namespace)
+		}
+		gw, ok := c.Gateway[utils.Keyname(ns, string(pr.Name))]
+		if !ok {
+			continue
+		}
+		if _, ok := c.GatewayClass[string(gw.Spec.GatewayClassName)]; !ok {
+			continue
+		}
+
+		ps := gatewayv1beta1.RouteParentStatus{
+			ParentRef:      pr,
+			ControllerName: gatewayv1beta1.GatewayController(c.ControllerName),
+			Conditions:     []metav1.Condition{},
+		}
+		for _, ops := range hr.Status.Parents {
+			if ops.ControllerName == ps.ControllerName && reflect.DeepEqual(ops.ParentRef, pr) {
+				ps.Conditions = ops.Conditions
+			}
+		}
+
+		accepted := metav1.Condition{
+			Type:               string(gatewayv1beta1.RouteConditionAccepted),
+			Status:             metav1.ConditionTrue,
+			Reason:             string(gatewayv1beta1.RouteReasonAccepted),
+			Message:            "Accepted",
+			ObservedGeneration: hr.Generation,
+		}
+		routetype := hrKind(hr)
+		if len(c._admittingListeners(gw, hr.Namespace, &pr, routetype)) == 0 {
+			accepted.Status = metav1.ConditionFalse
+			accepted.Reason = string(gatewayv1beta1.RouteReasonNotAllowedByListeners)
+			accepted.Message = notAllowedMessage(&pr)
+		} else if parseErr != nil {
+			accepted.Status = metav1.ConditionFalse
+			accepted.Reason = string(gatewayv1beta1.RouteReasonUnsupportedValue)
+			accepted.Message = parseErr.Error()
+		}
+		meta.SetStatusCondition(&ps.Conditions, accepted)
+
+		resolved.ObservedGeneration = hr.Generation
+		meta.SetStatusCondition(&ps.Conditions, resolved)
+
+		parents = append(parents, ps)
+	}
+	hr.Status.Parents = parents
+}
+
+// SetGRPCRouteStatus refreshes the parents' status of gr the same as
+// SetHTTPRouteStatus, with the httproute it's converted to.
+func (c *SIGCache) SetGRPCRouteStatus(gr *gatewayv1alpha2.GRPCRoute) {
+	hr := httpRouteOfGRPC(gr)
+	c.SetHTTPRouteStatus(hr)
+	gr.Status.RouteStatus = hr.Status.RouteStatus
+}
+
+// SetTLSRouteStatus refreshes the parents' status of tr that belong to this
+// controller, the same as SetHTTPRouteStatus.
+func (c *SIGCache) SetTLSRouteStatus(tr *gatewayv1alpha2.TLSRoute) {
+	defer utils.TimeItToPrometheus()()
+
+	_, parseErr := parseTLSRoute("", tr)
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	tr.Status.Parents = c._routeParentsStatus(tr, tr.Spec.ParentRefs, tr.Status.Parents, parseErr)
+}
+
+// SetTCPRouteStatus refreshes the parents' status of tcpr that belong to this controller.
+func (c *SIGCache) SetTCPRouteStatus(tcpr *gatewayv1alpha2.TCPRoute) {
+	defer utils.TimeItToPrometheus()()
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	_, l4Err := l4BackendOf(tcpr.Namespace, backendRefsOf(tcpr))
+
+	tcpr.Status.Parents = c._routeParentsStatus(tcpr, tcpr.Spec.ParentRefs, tcpr.Status.Parents, l4Err)
+}
+
+// SetUDPRouteStatus refreshes the parents' status of udpr that belong to this controller.
+func (c *SIGCache) SetUDPRouteStatus(udpr *gatewayv1alpha2.UDPRoute) {
+	defer utils.TimeItToPrometheus()()
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	_, l4Err := l4BackendOf(udpr.Namespace, backendRefsOf(udpr))
+
+	udpr.Status.Parents = c._routeParentsStatus(udpr, udpr.Spec.ParentRefs, udpr.Status.Parents, l4Err)
+}
+
+// TLSRoutesRefsOfGateway returns the tlsroutes whose parentRefs point to the given gateway.
+func (c *SIGCache) TLSRoutesRefsOfGateway(gwKey string) []*gatewayv1alpha2.TLSRoute {
+	defer utils.TimeItToPrometheus()()
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	trs := []*gatewayv1alpha2.TLSRoute{}
+	for _, tr := range c.TLSRoute {
+		if parentsReferTo(gwKey, tr.Namespace, tr.Spec.ParentRefs) {
+			trs = append(trs, tr)
+		}
+	}
+	return trs
+}
+
+// TCPRoutesRefsOfGateway returns the tcproutes whose parentRefs point to the given gateway.
+func (c *SIGCache) TCPRoutesRefsOfGateway(gwKey string) []*gatewayv1alpha2.TCPRoute {
+	defer utils.TimeItToPrometheus()()
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	tcprs := []*gatewayv1alpha2.TCPRoute{}
+	for _, tcpr := range c.TCPRoute {
+		if parentsReferTo(gwKey, tcpr.Namespace, tcpr.Spec.ParentRefs) {
+			tcprs = append(tcprs, tcpr)
+		}
+	}
+	return tcprs
+}
+
+// UDPRoutesRefsOfGateway returns the udproutes whose parentRefs point to the given gateway.
+func (c *SIGCache) UDPRoutesRefsOfGateway(gwKey string) []*gatewayv1alpha2.UDPRoute {
+	defer utils.TimeItToPrometheus()()
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	udprs := []*gatewayv1alpha2.UDPRoute{}
+	for _, udpr := range c.UDPRoute {
+		if parentsReferTo(gwKey, udpr.Namespace, udpr.Spec.ParentRefs) {
+			udprs = append(udprs, udpr)
+		}
+	}
+	return udprs
+}
+
+// _routeParentsStatus calculates the parents' status of the v1alpha2 route,
+// routeErr is the reason why (part of) the route cannot be deployed.
+func (c *SIGCache) _routeParentsStatus(route client.Object, prs []gatewayv1alpha2.ParentReference,
+	oparents []gatewayv1alpha2.RouteParentStatus, routeErr error) []gatewayv1alpha2.RouteParentStatus {
+
+	parents := []gatewayv1alpha2.RouteParentStatus{}
+	for _, ps := range oparents {
+		if ps.ControllerName != gatewayv1alpha2.GatewayController(c.ControllerName) {
+			parents = append(parents, ps)
+		}
+	}
+
+	resolved := metav1.Condition{
+		Type:               string(gatewayv1alpha2.RouteConditionResolvedRefs),
+		Status:             metav1.ConditionTrue,
+		Reason:             string(gatewayv1alpha2.RouteReasonResolvedRefs),
+		Message:            "ResolvedRefs",
+		ObservedGeneration: route.GetGeneration(),
+	}
+	routetype := reflect.TypeOf(route).Elem().Name()
+	for _, br := range backendRefsOf(route) {
+		key := backendKeysOf(route.GetNamespace(), []gatewayv1alpha2.BackendRef{br})[0]
+		if (br.Group != nil && *br.Group != "") || (br.Kind != nil && *br.Kind != "Service") {
+			resolved.Status = metav1.ConditionFalse
+			resolved.Reason = string(gatewayv1alpha2.RouteReasonInvalidKind)
+			resolved.Message = fmt.Sprintf("backendRef '%s' is not a Service", br.Name)
+		} else if !c._referenceGranted(routetype, route.GetNamespace(), "Service", key) {
+			resolved.Status = metav1.ConditionFalse
+			resolved.Reason = string(gatewayv1alpha2.RouteReasonRefNotPermitted)
+			resolved.Message = fmt.Sprintf("service '%s' is not permitted by any referencegrant", key)
+		} else if _, ok := c.Service[key]; !ok {
+			resolved.Status = metav1.ConditionFalse
+			resolved.Reason = string(gatewayv1alpha2.RouteReasonBackendNotFound)
+			resolved.Message = fmt.Sprintf("service '%s' not found", key)
+		}
+	}
+
+	for _, pr := range prs {
+		ns := route.GetNamespace()
+		if pr.Namespace != nil {
+			ns = string(*pr.Namespace)
+		}
+		gw, ok := c.Gateway[utils.Keyname(ns, string(pr.Name))]
+		if !ok {
+			continue
+		}
+		if _, ok := c.GatewayClass[string(gw.Spec.GatewayClassName)]; !ok {
+			continue
+		}
+
+		ps := gatewayv1alpha2.RouteParentStatus{
+			ParentRef:      pr,
+			ControllerName: gatewayv1alpha2.GatewayController(c.ControllerName),
+			Conditions:     []metav1.Condition{},
+		}
+		for _, ops := range oparents {
+			if ops.ControllerName == ps.ControllerName && reflect.DeepEqual(ops.ParentRef, pr) {
+				ps.Conditions = ops.Conditions
+			}
+		}
+
+		accepted := metav1.Condition{
+			Type:               string(gatewayv1alpha2.RouteConditionAccepted),
+			Status:             metav1.ConditionTrue,
+			Reason:             string(gatewayv1alpha2.RouteReasonAccepted),
+			Message:            "Accepted",
+			ObservedGeneration: route.GetGeneration(),
+		}
+		bpr := betaParentRef(pr)
+		if len(c._admittingListeners(gw, route.GetNamespace(), &bpr, routetype)) == 0 {
+			accepted.Status = metav1.ConditionFalse
+			accepted.Reason = string(gatewayv1alpha2.RouteReasonNotAllowedByListeners)
+			accepted.Message = notAllowedMessage(&bpr)
+		} else if routeErr != nil {
+			accepted.Status = metav1.ConditionFalse
+			accepted.Reason = string(gatewayv1alpha2.RouteReasonUnsupportedValue)
+			accepted.Message = routeErr.Error()
+		} else if msg := c._l4ConflictOf(gw, route, &bpr, routetype); msg != "" {
+			accepted.Status = metav1.ConditionFalse
+			accepted.Reason = RouteReasonConflicted
+			accepted.Message = msg
+		}
+		meta.SetStatusCondition(&ps.Conditions, accepted)
+		meta.SetStatusCondition(&ps.Conditions, resolved)
+
+		parents = append(parents, ps)
+	}
+	return parents
+}
+
+func notAllowedMessage(pr *gatewayv1beta1.ParentReference) string {
+	if pr.SectionName != nil {
+		return fmt.Sprintf("not allowed by listener '%s'", *pr.SectionName)
+	}
+	if pr.Port != nil {
+		return fmt.Sprintf("not allowed by any listener on port %d", *pr.Port)
+	}
+	return "not allowed by any listener"
+}
+
+func parentsReferTo(gwKey, routeNs string, prs []gatewayv1alpha2.ParentReference) bool {
+	for _, pr := range prs {
+		ns := routeNs
+		if pr.Namespace != nil {
+			ns = string(*pr.Namespace)
+		}
+		if utils.Keyname(ns, string(pr.Name)) == gwKey {
+			return true
+		}
+	}
+	return false
+}
+
+// HTTPRoutesRefsOfGateway returns the httproutes whose parentRefs point to
+// the given gateway, no matter whether they are allowed by its listeners.
+func (c *SIGCache) HTTPRoutesRefsOfGateway(gwKey string) []*gatewayv1beta1.HTTPRoute {
+	defer utils.TimeItToPrometheus()()
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	hrs := []*gatewayv1beta1.HTTPRoute{}
+	for _, hr := range c.HTTPRoute {
+		for _, pr := range hr.Spec.ParentRefs {
+			ns := hr.Namespace
+			if pr.Namespace != nil {
+				ns = string(*pr.Namespace)
+			}
+			if utils.Keyname(ns, string(pr.Name)) == gwKey {
+				hrs = append(hrs, hr)
+				break
+			}
+		}
+	}
+	return hrs
+}
+
+// GRPCRoutesRefsOfGateway returns the grpcroutes whose parentRefs point to the given gateway.
+func (c *SIGCache) GRPCRoutesRefsOfGateway(gwKey string) []*gatewayv1alpha2.GRPCRoute {
+	defer utils.TimeItToPrometheus()()
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	grs := []*gatewayv1alpha2.GRPCRoute{}
+	for _, gr := range c.GRPCRoute {
+		if parentsReferTo(gwKey, gr.Namespace, gr.Spec.ParentRefs) {
+			grs = append(grs, gr)
+		}
+	}
+	return grs
+}
+
+func (c *SIGCache) _resolvedRefsCondition(hr *gatewayv1beta1.HTTPRoute) metav1.Condition {
+	cond := metav1.Condition{
+		Type:    string(gatewayv1beta1.RouteConditionResolvedRefs),
+		Status:  metav1.ConditionTrue,
+		Reason:  string(gatewayv1beta1.RouteReasonResolvedRefs),
+		Message: "ResolvedRefs",
+	}
+	for _, rl := range hr.Spec.Rules {
+		for _, br := range rl.BackendRefs {
+			if (br.Group != nil && *br.Group != "") || (br.Kind != nil && *br.Kind != "Service") {
+				cond.Status = metav1.ConditionFalse
+				cond.Reason = string(gatewayv1beta1.RouteReasonInvalidKind)
+				cond.Message = fmt.Sprintf("backendRef '%s' is not a Service", br.Name)
+				return cond
+			}
+			ns := hr.Namespace
+			if br.Namespace != nil {
+				ns = string(*br.Namespace)
+			}
+			if !c._referenceGranted(hrKind(hr), hr.Namespace, "Service", utils.Keyname(ns, string(br.Name))) {
+				cond.Status = metav1.ConditionFalse
+				cond.Reason = string(gatewayv1beta1.RouteReasonRefNotPermitted)
+				cond.Message = fmt.Sprintf("service '%s' is not permitted by any referencegrant", utils.Keyname(ns, string(br.Name)))
+				return cond
+			}
+			if _, ok := c.Service[utils.Keyname(ns, string(br.Name))]; !ok {
+				cond.Status = metav1.ConditionFalse
+				cond.Reason = string(gatewayv1beta1.RouteReasonBackendNotFound)
+				cond.Message = fmt.Sprintf("service '%s' not found", utils.Keyname(ns, string(br.Name)))
+				return cond
+			}
+		}
+		for _, fl := range rl.Filters {
+			if key := mirrorKeyOf(hr, &fl); key != "" {
+				if !c._referenceGranted(hrKind(hr), hr.Namespace, "Service", key) {
+					cond.Status = metav1.ConditionFalse
+					cond.Reason = string(gatewayv1beta1.RouteReasonRefNotPermitted)
+					cond.Message = fmt.Sprintf("mirrored service '%s' is not permitted by any referencegrant", key)
+					return cond
+				}
+				if _, ok := c.Service[key]; !ok {
+					cond.Status = metav1.ConditionFalse
+					cond.Reason = string(gatewayv1beta1.RouteReasonBackendNotFound)
+					cond.Message = fmt.Sprintf("mirrored service '%s' not found", key)
+					return cond
+				}
+			}
+		}
+	}
+	return cond
+}
+
+func (c *SIGCache) _attachedRoutesCount(gw *gatewayv1beta1.Gateway, listener *gatewayv1beta1.Listener) int32 {
+	count := int32(0)
+	for _, hr := range c._httpRoutes() {
+		for _, pr := range hr.Spec.ParentRefs {
+			ns := hr.Namespace
+			if pr.Namespace != nil {
+				ns = string(*pr.Namespace)
+			}
+			if utils.Keyname(ns, string(pr.Name)) != utils.Keyname(gw.Namespace, gw.Name) {
+				continue
+			}
+			if c._listenerAdmits(gw, listener, hr.Namespace, &pr, hrKind(hr)) {
+				count++
+				break
+			}
+		}
+	}
+	for _, tr := range c.TLSRoute {
+		if c._parentsAttachedToListener(gw, listener, tr.Namespace, tr.Spec.ParentRefs, reflect.TypeOf(*tr).Name()) {
+			count++
+		}
+	}
+	for _, tcpr := range c.TCPRoute {
+		if c._parentsAttachedToListener(gw, listener, tcpr.Namespace, tcpr.Spec.ParentRefs, reflect.TypeOf(*tcpr).Name()) {
+			count++
+		}
+	}
+	for _, udpr := range c.UDPRoute {
+		if c._parentsAttachedToListener(gw, listener, udpr.Namespace, udpr.Spec.ParentRefs, reflect.TypeOf(*udpr).Name()) {
+			count++
+		}
+	}
+	return count
+}
+
+func (c *SIGCache) _parentsAttachedToListener(gw *gatewayv1beta1.Gateway, listener *gatewayv1beta1.Listener,
+	routeNs string, prs []gatewayv1alpha2.ParentReference, routetype string) bool {
+
+	for _, pr := range prs {
+		if !parentsReferTo(utils.Keyname(gw.Namespace, gw.Name), routeNs, []gatewayv1alpha2.ParentReference{pr}) {
+			continue
+		}
+		bpr := betaParentRef(pr)
+		if c._listenerAdmits(gw, listener, routeNs, &bpr, routetype) {
+			return true
+		}
+	}
+	return false
+}
+
+// _listenerAdmits tells whether the listener of gw is selected by pr and admits the route.
+func (c *SIGCache) _listenerAdmits(gw *gatewayv1beta1.Gateway, listener *gatewayv1beta1.Listener,
+	routeNs string, pr *gatewayv1beta1.ParentReference, routetype string) bool {
+
+	for _, l := range c._admittingListeners(gw, routeNs, pr, routetype) {
+		if l.Name == listener.Name {
+			return true
+		}
+	}
+	return false
+}
@@ -3,37 +3,199 @@ package pkg
 import (
 	"context"
 	"sync"
+	"time"
 
+	f5_bigip "gitee.com/zongzw/f5-bigip-rest/bigip"
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
 	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
 )
 
 type DeployRequest struct {
-	Meta       string
-	From       *map[string]interface{}
-	To         *map[string]interface{}
-	Partition  string
-	StatusFunc func()
+	Meta      string
+	From      *map[string]interface{}
+	To        *map[string]interface{}
+	Partition string
+	// StatusFunc is called with the result once the request is done on all the BIG-IPs.
+	// The error is a *DeployError if any of the BIG-IPs failed.
+	StatusFunc func(err error)
 	Context    context.Context
 }
 
+// DeployError reports the BIG-IPs failed in a DeployRequest.
+// Retries are the copies of the failed request, one for each failed BIG-IP,
+// which can be sent to PendingDeploys again as they are.
+type DeployError struct {
+	Errors  map[string]error
+	Retries []DeployRequest
+}
+
+// DriftReport is a resource found drifted on the BIG-IP by the resync, with
+// Err the result of its repair.
+type DriftReport struct {
+	BIGIP     string
+	Partition string
+	Folder    string
+	Kind      string
+	Name      string
+	Reason    string
+	Err       error
+}
+
 type CtxKeyType string
 
+// statusQueue calls the StatusFuncs of the requests in order on its own
+// goroutine, so that their k8s API calls never block the deployments.
+type statusQueue struct {
+	mutex   sync.Mutex
+	reports []func()
+	signal  chan struct{}
+}
+
+// deployWorker deploys the requests to one BIG-IP in order.
+type deployWorker struct {
+	bigip   *f5_bigip.BIGIP
+	mutex   sync.Mutex
+	queue   []*deployJob
+	signal  chan struct{}
+	breaker circuitBreaker
+	// the count of the failed jobs being retried, and the given up ones, by partitions.
+	failing   map[string]int
+	abandoned map[string]bool
+}
+
+type deployJob struct {
+	request    DeployRequest
+	collector  *deployCollector
+	enqueuedAt time.Time
+	attempt    int
+}
+
+// deployCollector collects the results of a request from its BIG-IPs.
+type deployCollector struct {
+	mutex   sync.Mutex
+	request DeployRequest
+	pending int
+	failed  map[string]error
+}
+
+// circuitBreaker is opened by the consecutive failures of a BIG-IP, it's only
+// accessed by the worker of the BIG-IP.
+type circuitBreaker struct {
+	failures int
+	openedAt time.Time
+}
+
 type ParseRequest struct {
 	Gateway   *gatewayv1beta1.Gateway
 	HTTPRoute *gatewayv1beta1.HTTPRoute
 }
 
+// l4Route is a tcproute or udproute with its only backend.
+type l4Route struct {
+	obj       client.Object
+	routetype string
+	prs       []gatewayv1alpha2.ParentReference
+	svcKey    string
+}
+
+// httpBranch is a match of a rule of the httproute, a nil match matches all.
+type httpBranch struct {
+	hr         *gatewayv1beta1.HTTPRoute
+	ruleIndex  int
+	matchIndex int
+	match      *gatewayv1beta1.HTTPRouteMatch
+}
+
+type iRuleAction struct {
+	init   string
+	action string
+	// response is the actions of the rule in HTTP_RESPONSE, keyed by the rule name.
+	response map[string]string
+	mirrored bool
+}
+
+// backendPersistence is the persistence to the members of the pool of a service.
+type backendPersistence struct {
+	// method is cookie or source-address.
+	method  string
+	cookie  string
+	timeout int
+}
+
+type requestLogging struct {
+	sampleRate    float64
+	redactHeaders []string
+	hslPool       string
+}
+
 type SIGCache struct {
 	mutex          sync.RWMutex
 	SyncedAtStart  bool
 	ControllerName string
 	Gateway        map[string]*gatewayv1beta1.Gateway
 	HTTPRoute      map[string]*gatewayv1beta1.HTTPRoute
+	TLSRoute       map[string]*gatewayv1alpha2.TLSRoute
+	GRPCRoute      map[string]*gatewayv1alpha2.GRPCRoute
+	TCPRoute       map[string]*gatewayv1alpha2.TCPRoute
+	UDPRoute       map[string]*gatewayv1alpha2.UDPRoute
 	Endpoints      map[string]*v1.Endpoints
 	Service        map[string]*v1.Service
+	Secret         map[string]*v1.Secret
+	ConfigMap      map[string]*v1.ConfigMap
 	GatewayClass   map[string]*gatewayv1beta1.GatewayClass
 	Namespace      map[string]*v1.Namespace
+	ReferenceGrant map[string]*gatewayv1alpha2.ReferenceGrant
+	// the readiness probes of the pods behind the services, keyed by the services.
+	ReadinessProbe map[string]*v1.Probe
+	// the BIGIPGatewayClassParameters, keyed by namespace/name.
+	ClassParameters map[string]*BIGIPGatewayClassParameters
+
+	// BackendPartition is the default partition of the pools.
+	BackendPartition string
+}
+
+// BIGIPGatewayClassParameters is referred by the parametersRef of GatewayClass,
+// it tunes how the gateways of the class are deployed to BIG-IP.
+type BIGIPGatewayClassParameters struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec BIGIPGatewayClassParametersSpec `json:"spec,omitempty"`
+}
+
+type BIGIPGatewayClassParametersSpec struct {
+	// Partition is where the gateways of the class are deployed to, the class name by default.
+	Partition string `json:"partition,omitempty"`
+	// BackendPartition is where the pools of the class are deployed to, the --backend-partition by default.
+	BackendPartition string `json:"backendPartition,omitempty"`
+	// RouteDomain is appended to the virtual addresses as "%<id>".
+	RouteDomain *int `json:"routeDomain,omitempty"`
+	// VLANs the virtuals are enabled on, all vlans by default.
+	VLANs []string `json:"vlans,omitempty"`
+	// SNAT is the default of the gateways without the f5.io/snat annotation.
+	SNAT *BIGIPGatewayClassSNAT `json:"snat,omitempty"`
+	// Profiles override the profiles of the virtuals, with full paths, e.g. /Common/http.
+	Profiles *BIGIPGatewayClassProfiles `json:"profiles,omitempty"`
+}
+
+type BIGIPGatewayClassSNAT struct {
+	Mode      string   `json:"mode"`
+	Addresses []string `json:"addresses,omitempty"`
+}
+
+type BIGIPGatewayClassProfiles struct {
+	HTTP      string `json:"http,omitempty"`
+	TCP       string `json:"tcp,omitempty"`
+	FastL4    string `json:"fastl4,omitempty"`
+	UDP       string `json:"udp,omitempty"`
+	ClientSSL string `json:"clientssl,omitempty"`
+	ServerSSL string `json:"serverssl,omitempty"`
+	// HTTP2 and HTTPRouter are added to the HTTP and HTTPS listeners with grpcroutes.
+	HTTP2      string `json:"http2,omitempty"`
+	HTTPRouter string `json:"httprouter,omitempty"`
 }
 
 type BIGIPConfigs []BIGIPConfig
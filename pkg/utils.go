@@ -1,29 +1,231 @@
 package pkg
 
 import (
+	"crypto/sha256"
+	"fmt"
 	"reflect"
+	"regexp"
 	"strings"
 
+	"gitee.com/zongzw/f5-bigip-rest/utils"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	gatewayv1alpha2 "sigs.k8s.io/gateway-api/apis/v1alpha2"
 	gatewayv1beta1 "sigs.k8s.io/gateway-api/apis/v1beta1"
 )
 
 func hrName(hr *gatewayv1beta1.HTTPRoute) string {
+	if hrKind(hr) == grpcRouteKind {
+		return strings.Join([]string{"gr", hr.Namespace, hr.Name}, ".")
+	}
 	return strings.Join([]string{"hr", hr.Namespace, hr.Name}, ".")
 }
 
-func hrParentName(hr *gatewayv1beta1.HTTPRoute, pr *gatewayv1beta1.ParentReference) string {
-	ns := hr.Namespace
+// hrKind returns the kind of the route hr is parsed from, the grpcroutes are
+// deployed as the httproutes converted by httpRouteOfGRPC.
+func hrKind(hr *gatewayv1beta1.HTTPRoute) string {
+	if hr.Kind == grpcRouteKind {
+		return grpcRouteKind
+	}
+	return reflect.TypeOf(*hr).Name()
+}
+
+// httpRouteOfGRPC converts gr to the httproute matching the same requests.
+// The service and method of a grpc request are in its path: /<service>/<method>.
+func httpRouteOfGRPC(gr *gatewayv1alpha2.GRPCRoute) *gatewayv1beta1.HTTPRoute {
+	hr := &gatewayv1beta1.HTTPRoute{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       grpcRouteKind,
+			APIVersion: gatewayv1alpha2.GroupVersion.String(),
+		},
+		ObjectMeta: *gr.ObjectMeta.DeepCopy(),
+		Spec: gatewayv1beta1.HTTPRouteSpec{
+			CommonRouteSpec: *gr.Spec.CommonRouteSpec.DeepCopy(),
+			Hostnames:       append([]gatewayv1beta1.Hostname{}, gr.Spec.Hostnames...),
+		},
+		Status: gatewayv1beta1.HTTPRouteStatus{
+			RouteStatus: *gr.Status.RouteStatus.DeepCopy(),
+		},
+	}
+	for _, rl := range gr.Spec.Rules {
+		hrl := gatewayv1beta1.HTTPRouteRule{}
+		for _, m := range rl.Matches {
+			hm := gatewayv1beta1.HTTPRouteMatch{Path: grpcPathMatchOf(m.Method)}
+			for _, h := range m.Headers {
+				hm.Headers = append(hm.Headers, gatewayv1beta1.HTTPHeaderMatch{
+					Type:  h.Type,
+					Name:  gatewayv1beta1.HTTPHeaderName(h.Name),
+					Value: h.Value,
+				})
+			}
+			hrl.Matches = append(hrl.Matches, hm)
+		}
+		hrl.Filters = httpFiltersOfGRPC(rl.Filters)
+		for _, br := range rl.BackendRefs {
+			hrl.BackendRefs = append(hrl.BackendRefs, gatewayv1beta1.HTTPBackendRef{
+				BackendRef: *br.BackendRef.DeepCopy(),
+				Filters:    httpFiltersOfGRPC(br.Filters),
+			})
+		}
+		hr.Spec.Rules = append(hr.Spec.Rules, hrl)
+	}
+	return hr
+}
+
+// grpcPathMatchOf returns the path match of the grpc method match, nil matches all.
+func grpcPathMatchOf(mm *gatewayv1alpha2.GRPCMethodMatch) *gatewayv1beta1.HTTPPathMatch {
+	if mm == nil || (mm.Service == nil && mm.Method == nil) {
+		return nil
+	}
+	service, method := "", ""
+	if mm.Service != nil {
+		service = *mm.Service
+	}
+	if mm.Method != nil {
+		method = *mm.Method
+	}
+
+	exact := mm.Type == nil || *mm.Type == gatewayv1alpha2.GRPCMethodMatchExact
+	pathType := gatewayv1beta1.PathMatchRegularExpression
+	value := ""
+	switch {
+	case exact && service != "" && method != "":
+		pathType, value = gatewayv1beta1.PathMatchExact, "/"+service+"/"+method
+	case exact && service != "":
+		// the trailing slash keeps "/svc" from matching "/svcX/method".
+		pathType, value = gatewayv1beta1.PathMatchPathPrefix, "/"+service+"/"
+	case exact:
+		value = "^/[^/]+/" + regexp.QuoteMeta(method) + "$"
+	default:
+		if service == "" {
+			service = "[^/]+"
+		}
+		if method == "" {
+			method = "[^/]+"
+		}
+		value = "^/" + service + "/" + method + "$"
+	}
+	return &gatewayv1beta1.HTTPPathMatch{Type: &pathType, Value: &value}
+}
+
+// httpFiltersOfGRPC converts the grpc filters, which are the same as the ones
+// of httproute except the type.
+func httpFiltersOfGRPC(fls []gatewayv1alpha2.GRPCRouteFilter) []gatewayv1beta1.HTTPRouteFilter {
+	hfls := []gatewayv1beta1.HTTPRouteFilter{}
+	for _, fl := range fls {
+		hfls = append(hfls, gatewayv1beta1.HTTPRouteFilter{
+			Type:                   gatewayv1beta1.HTTPRouteFilterType(fl.Type),
+			RequestHeaderModifier:  fl.RequestHeaderModifier,
+			ResponseHeaderModifier: fl.ResponseHeaderModifier,
+			RequestMirror:          fl.RequestMirror,
+			ExtensionRef:           fl.ExtensionRef,
+		})
+	}
+	return hfls
+}
+
+func trName(tr *gatewayv1alpha2.TLSRoute) string {
+	return strings.Join([]string{"tr", tr.Namespace, tr.Name}, ".")
+}
+
+// SecretReferable tells whether the secret can be referred: only tls secrets
+// as certificates of listeners, and the ones with ca.crt as the CA
+// certificates of backend TLS.
+func SecretReferable(scrt *v1.Secret) bool {
+	return scrt.Type == v1.SecretTypeTLS || len(scrt.Data["ca.crt"]) > 0
+}
+
+// ConfigMapReferable tells whether the configmap can be referred as the CA
+// certificates of backend TLS.
+func ConfigMapReferable(cm *v1.ConfigMap) bool {
+	return cm.Data["ca.crt"] != ""
+}
+
+// parentListeners returns the listeners of gw selected by the parentRef of a
+// route in routeNs. A nil sectionName selects all the listeners, and a non-nil
+// port narrows them down to the ones listening on it.
+func parentListeners(gw *gatewayv1beta1.Gateway, routeNs string, pr *gatewayv1beta1.ParentReference) []*gatewayv1beta1.Listener {
+	ns := routeNs
 	if pr.Namespace != nil {
 		ns = string(*pr.Namespace)
 	}
-	sn := ""
+	listeners := []*gatewayv1beta1.Listener{}
+	if gw == nil || utils.Keyname(ns, string(pr.Name)) != utils.Keyname(gw.Namespace, gw.Name) {
+		return listeners
+	}
+	for i, listener := range gw.Spec.Listeners {
+		if pr.SectionName != nil && *pr.SectionName != listener.Name {
+			continue
+		}
+		if pr.Port != nil && *pr.Port != listener.Port {
+			continue
+		}
+		listeners = append(listeners, &gw.Spec.Listeners[i])
+	}
+	return listeners
+}
+
+// betaParentRef converts the parentRef of a v1alpha2 route.
+func betaParentRef(pr gatewayv1alpha2.ParentReference) gatewayv1beta1.ParentReference {
+	bpr := gatewayv1beta1.ParentReference{Name: gatewayv1beta1.ObjectName(pr.Name)}
+	if pr.Group != nil {
+		group := gatewayv1beta1.Group(*pr.Group)
+		bpr.Group = &group
+	}
+	if pr.Kind != nil {
+		kind := gatewayv1beta1.Kind(*pr.Kind)
+		bpr.Kind = &kind
+	}
+	if pr.Namespace != nil {
+		ns := gatewayv1beta1.Namespace(*pr.Namespace)
+		bpr.Namespace = &ns
+	}
 	if pr.SectionName != nil {
-		sn = string(*pr.SectionName)
+		sn := gatewayv1beta1.SectionName(*pr.SectionName)
+		bpr.SectionName = &sn
+	}
+	if pr.Port != nil {
+		port := gatewayv1beta1.PortNumber(*pr.Port)
+		bpr.Port = &port
+	}
+	return bpr
+}
+
+// backendRefsOf returns the backendRefs of all the rules of the tlsroute, tcproute or udproute.
+func backendRefsOf(route client.Object) []gatewayv1alpha2.BackendRef {
+	brs := []gatewayv1alpha2.BackendRef{}
+	switch r := route.(type) {
+	case *gatewayv1alpha2.TLSRoute:
+		for _, rl := range r.Spec.Rules {
+			brs = append(brs, rl.BackendRefs...)
+		}
+	case *gatewayv1alpha2.TCPRoute:
+		for _, rl := range r.Spec.Rules {
+			brs = append(brs, rl.BackendRefs...)
+		}
+	case *gatewayv1alpha2.UDPRoute:
+		for _, rl := range r.Spec.Rules {
+			brs = append(brs, rl.BackendRefs...)
+		}
+	}
+	return brs
+}
+
+func backendKeysOf(routeNs string, brs []gatewayv1alpha2.BackendRef) []string {
+	keys := []string{}
+	for _, br := range brs {
+		ns := routeNs
+		if br.Namespace != nil {
+			ns = string(*br.Namespace)
+		}
+		keys = append(keys, utils.Keyname(ns, string(br.Name)))
 	}
-	return strings.Join([]string{"gw", ns, string(pr.Name), sn}, ".")
+	return keys
 }
 
 func gwListenerName(gw *gatewayv1beta1.Gateway, ls *gatewayv1beta1.Listener) string {
@@ -63,16 +265,15 @@ func routeMatches(gwNamespace string, listener *gatewayv1beta1.Listener, routeNa
 	allowedKinds := listener.AllowedRoutes.Kinds
 	if len(allowedKinds) == 0 {
 		switch listener.Protocol {
-		case gatewayv1beta1.HTTPProtocolType:
-			matchedKind = routeType == reflect.TypeOf(gatewayv1beta1.HTTPRoute{}).Name()
-		case gatewayv1beta1.HTTPSProtocolType:
-			return false
+		case gatewayv1beta1.HTTPProtocolType, gatewayv1beta1.HTTPSProtocolType:
+			matchedKind = routeType == reflect.TypeOf(gatewayv1beta1.HTTPRoute{}).Name() ||
+				routeType == reflect.TypeOf(gatewayv1alpha2.GRPCRoute{}).Name()
 		case gatewayv1beta1.TLSProtocolType:
-			return false
+			matchedKind = routeType == reflect.TypeOf(gatewayv1alpha2.TLSRoute{}).Name()
 		case gatewayv1beta1.TCPProtocolType:
-			return false
+			matchedKind = routeType == reflect.TypeOf(gatewayv1alpha2.TCPRoute{}).Name()
 		case gatewayv1beta1.UDPProtocolType:
-			return false
+			matchedKind = routeType == reflect.TypeOf(gatewayv1alpha2.UDPRoute{}).Name()
 		}
 	} else {
 		for _, k := range allowedKinds {
@@ -89,3 +290,185 @@ func routeMatches(gwNamespace string, listener *gatewayv1beta1.Listener, routeNa
 
 	return matchedFrom && matchedKind
 }
+
+func protocolSupported(protocol gatewayv1beta1.ProtocolType) bool {
+	switch protocol {
+	case gatewayv1beta1.HTTPProtocolType, gatewayv1beta1.HTTPSProtocolType, gatewayv1beta1.TLSProtocolType,
+		gatewayv1beta1.TCPProtocolType, gatewayv1beta1.UDPProtocolType:
+		return true
+	default:
+		return false
+	}
+}
+
+func supportedKindsOf(listener *gatewayv1beta1.Listener) []gatewayv1beta1.RouteGroupKind {
+	group := gatewayv1beta1.Group(gatewayv1beta1.GroupName)
+	kinds := []gatewayv1beta1.RouteGroupKind{}
+	switch listener.Protocol {
+	case gatewayv1beta1.HTTPProtocolType, gatewayv1beta1.HTTPSProtocolType:
+		kinds = append(kinds, gatewayv1beta1.RouteGroupKind{
+			Group: &group,
+			Kind:  gatewayv1beta1.Kind(reflect.TypeOf(gatewayv1beta1.HTTPRoute{}).Name()),
+		}, gatewayv1beta1.RouteGroupKind{
+			Group: &group,
+			Kind:  gatewayv1beta1.Kind(reflect.TypeOf(gatewayv1alpha2.GRPCRoute{}).Name()),
+		})
+	case gatewayv1beta1.TLSProtocolType:
+		kinds = append(kinds, gatewayv1beta1.RouteGroupKind{
+			Group: &group,
+			Kind:  gatewayv1beta1.Kind(reflect.TypeOf(gatewayv1alpha2.TLSRoute{}).Name()),
+		})
+	case gatewayv1beta1.TCPProtocolType:
+		kinds = append(kinds, gatewayv1beta1.RouteGroupKind{
+			Group: &group,
+			Kind:  gatewayv1beta1.Kind(reflect.TypeOf(gatewayv1alpha2.TCPRoute{}).Name()),
+		})
+	case gatewayv1beta1.UDPProtocolType:
+		kinds = append(kinds, gatewayv1beta1.RouteGroupKind{
+			Group: &group,
+			Kind:  gatewayv1beta1.Kind(reflect.TypeOf(gatewayv1alpha2.UDPRoute{}).Name()),
+		})
+	}
+	if listener.AllowedRoutes == nil || len(listener.AllowedRoutes.Kinds) == 0 {
+		return kinds
+	}
+
+	rlt := []gatewayv1beta1.RouteGroupKind{}
+	for _, k := range listener.AllowedRoutes.Kinds {
+		if k.Group != nil && *k.Group != gatewayv1beta1.GroupName {
+			continue
+		}
+		for _, sk := range kinds {
+			if k.Kind == sk.Kind {
+				rlt = append(rlt, sk)
+			}
+		}
+	}
+	return rlt
+}
+
+func certificateRefsOf(listener *gatewayv1beta1.Listener) []gatewayv1beta1.SecretObjectReference {
+	if listener.Protocol != gatewayv1beta1.HTTPSProtocolType || listener.TLS == nil {
+		return []gatewayv1beta1.SecretObjectReference{}
+	}
+	return listener.TLS.CertificateRefs
+}
+
+// secretName returns the name of the ssl cert and key on BIG-IP for the secret.
+// The hash of the content is a part of it, so that a rotated certificate is
+// created as new objects and the client-ssl profile is rolled to it.
+func secretName(scrt *v1.Secret) string {
+	hash := sha256.Sum256(append(scrt.Data[v1.TLSCertKey], scrt.Data[v1.TLSPrivateKeyKey]...))
+	return strings.Join([]string{"scrt", scrt.Namespace, scrt.Name, fmt.Sprintf("%x", hash[:4])}, ".")
+}
+
+// mirrorKeyOf returns the key of the service mirrored by the filter, or "" if it's not a RequestMirror one.
+func mirrorKeyOf(hr *gatewayv1beta1.HTTPRoute, fl *gatewayv1beta1.HTTPRouteFilter) string {
+	if fl.Type != gatewayv1beta1.HTTPRouteFilterRequestMirror || fl.RequestMirror == nil {
+		return ""
+	}
+	br := fl.RequestMirror.BackendRef
+	ns := hr.Namespace
+	if br.Namespace != nil {
+		ns = string(*br.Namespace)
+	}
+	return utils.Keyname(ns, string(br.Name))
+}
+
+func contains(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// l4BackendOf returns the service key of the only backendRef of a tcproute or udproute.
+func l4BackendOf(routeNs string, brs []gatewayv1alpha2.BackendRef) (string, error) {
+	if len(brs) != 1 {
+		return "", fmt.Errorf("%d backendRefs found, only one is supported", len(brs))
+	}
+	br := brs[0]
+	if (br.Group != nil && *br.Group != "") || (br.Kind != nil && *br.Kind != "Service") {
+		return "", fmt.Errorf("backendRef '%s' is not a Service", br.Name)
+	}
+	return backendKeysOf(routeNs, brs)[0], nil
+}
+
+// olderThan orders the objects by creation time, then by namespace/name.
+func olderThan(a, b client.Object) bool {
+	ta, tb := a.GetCreationTimestamp(), b.GetCreationTimestamp()
+	if !ta.Equal(&tb) {
+		return ta.Before(&tb)
+	}
+	return utils.Keyname(a.GetNamespace(), a.GetName()) < utils.Keyname(b.GetNamespace(), b.GetName())
+}
+
+// BackendTLSEnabled tells whether BIG-IP speaks TLS to the pods of svc.
+func BackendTLSEnabled(svc *v1.Service) bool {
+	return svc != nil && svc.Annotations[AnnotationBackendTLSHostname] != ""
+}
+
+// backendTLSRefsOf returns the ConfigMaps and Secrets referred by the backend
+// TLS of svc, in the form of "<kind>/<namespace>/<name>".
+func backendTLSRefsOf(svc *v1.Service) []string {
+	refs := []string{}
+	if !BackendTLSEnabled(svc) {
+		return refs
+	}
+	if ca := svc.Annotations[AnnotationBackendTLSCACertificate]; ca != "" {
+		if kn := strings.SplitN(ca, "/", 2); len(kn) == 2 {
+			refs = append(refs, kn[0]+"/"+utils.Keyname(svc.Namespace, kn[1]))
+		}
+	}
+	if cert := svc.Annotations[AnnotationBackendTLSClientCertificate]; cert != "" {
+		refs = append(refs, "Secret/"+utils.Keyname(svc.Namespace, cert))
+	}
+	return refs
+}
+
+// ListenersAffectedBy tells whether the change of the service from osvc to
+// nsvc changes the configs of the listeners routing to it.
+func ListenersAffectedBy(osvc, nsvc *v1.Service) bool {
+	if BackendTLSEnabled(osvc) != BackendTLSEnabled(nsvc) {
+		return true
+	}
+	opersist, _ := persistenceOf(osvc)
+	npersist, _ := persistenceOf(nsvc)
+	return opersist.command() != npersist.command()
+}
+
+func ClassParametersGVK() schema.GroupVersionKind {
+	return schema.GroupVersionKind{
+		Group:   ClassParametersGroup,
+		Version: ClassParametersVersion,
+		Kind:    ClassParametersKind,
+	}
+}
+
+// ClassParametersFromUnstructured converts the watched object to BIGIPGatewayClassParameters.
+func ClassParametersFromUnstructured(obj *unstructured.Unstructured) (*BIGIPGatewayClassParameters, error) {
+	var params BIGIPGatewayClassParameters
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.UnstructuredContent(), &params); err != nil {
+		return nil, fmt.Errorf("failed to convert %s %s: %s",
+			ClassParametersKind, utils.Keyname(obj.GetNamespace(), obj.GetName()), err.Error())
+	}
+	return &params, nil
+}
+
+// tclQuoted returns s as a double-quoted word of the iRule, in which the Tcl
+// substitutions are escaped, so that the values from the routes, like the
+// header values with spaces, brackets or dollars, are kept as they are.
+func tclQuoted(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, `[`, `\[`, `]`, `\]`).Replace(s) + `"`
+}
+
+// classCreatedBefore tells whether the gatewayclass a is created before b,
+// by the creationTimestamp and then the name.
+func classCreatedBefore(a, b *gatewayv1beta1.GatewayClass) bool {
+	if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+		return a.CreationTimestamp.Before(&b.CreationTimestamp)
+	}
+	return a.Name < b.Name
+}
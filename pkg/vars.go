@@ -1,6 +1,12 @@
 package pkg
 
-import f5_bigip "gitee.com/zongzw/f5-bigip-rest/bigip"
+import (
+	"regexp"
+	"time"
+
+	f5_bigip "gitee.com/zongzw/f5-bigip-rest/bigip"
+	"github.com/prometheus/client_golang/prometheus"
+)
 
 var (
 	PendingDeploys chan DeployRequest
@@ -8,10 +14,149 @@ var (
 	BIGIPs         []*f5_bigip.BIGIP
 	BIPConfigs     BIGIPConfigs
 	BIPPassword    string
+	statusReports  = &statusQueue{reports: []func(){}, signal: make(chan struct{}, 1)}
+	// DeployDebounce is how long a request waits in the queue of a BIG-IP for
+	// the following requests of the same partition to be merged into it.
+	DeployDebounce time.Duration
+
+	// OutOfSyncPartitions is the count of the partitions of each BIG-IP whose
+	// deployments failed, they are in sync again once retried successfully.
+	OutOfSyncPartitions = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "bigip_out_of_sync_partitions",
+		Help: "The count of the partitions out of sync because of the failed deployments",
+	}, []string{"bigip"})
+
+	// ResyncInterval is how often the resources on the BIG-IPs are checked for drifts.
+	ResyncInterval time.Duration
+	// ReconcileDeleteOrphans is whether the orphaned resources and the unused
+	// partitions found at startup are deleted, they are only logged if false.
+	ReconcileDeleteOrphans bool
+	// DriftedResources is the count of the drifted resources found in the last resync.
+	DriftedResources = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "bigip_drifted_resources",
+		Help: "The count of the resources found modified or deleted on the BIG-IP in the last resync",
+	}, []string{"bigip", "partition"})
 )
 
 const (
 	CtxKey_DeletePartition CtxKeyType = "delete_partition"
 	CtxKey_CreatePartition CtxKeyType = "create_partition"
 	CtxKey_SpecifiedBIGIP  CtxKeyType = "specified_bigip"
+	// CtxKey_GivenUpRequest marks the given up request sent again by its object,
+	// whose To is stale and recomputed the same as the retries.
+	CtxKey_GivenUpRequest CtxKeyType = "given_up_request"
+)
+
+// grpcRouteKind is the kind of the httproutes converted from the grpcroutes.
+const grpcRouteKind = "GRPCRoute"
+
+// OwnedKinds are the kinds of the resources created by the controller in the
+// partitions of classes and backends, the orphaned ones named by the controller
+// are deleted at startup. The nodes, arps and ssl files may be shared with the
+// others, they are never deleted at startup.
+var OwnedKinds = []string{
+	"ltm/virtual",
+	"ltm/policy",
+	"ltm/rule",
+	"ltm/snatpool",
+	"ltm/pool",
+	"ltm/monitor/http",
+	"ltm/monitor/https",
+	"ltm/monitor/tcp",
+	"ltm/monitor/udp",
+	"ltm/monitor/gateway-icmp",
+	"ltm/profile/client-ssl",
+	"ltm/profile/server-ssl",
+}
+
+// serviceResourceName is the name of the pools, monitors and server-ssl
+// profiles of the services: <namespace>.<name>.
+var serviceResourceName = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?\.[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// writeOnlyFields are the fields of the desired resources not returned by the
+// BIG-IP, which are not compared for drifts: legacy of the policies, and
+// sourcePath of the ssl files.
+var writeOnlyFields = map[string]bool{
+	"legacy":     true,
+	"sourcePath": true,
+}
+
+// Gateway condition types and reasons, the same strings as the ones of gateway-api v0.6.0.
+const (
+	GatewayConditionAccepted   = "Accepted"
+	GatewayConditionProgrammed = "Programmed"
+
+	GatewayReasonAccepted   = "Accepted"
+	GatewayReasonProgrammed = "Programmed"
+	GatewayReasonInvalid    = "Invalid"
+	GatewayReasonPending    = "Pending"
+
+	// RouteReasonConflicted is set on the tcproutes and udproutes whose
+	// listeners are all taken by the older routes.
+	RouteReasonConflicted = "Conflicted"
+)
+
+// The annotations of the Gateway or HTTPRoute which turn on the request logging
+// of the iRules, the ones of an httproute override the ones of its gateway.
+const (
+	AnnotationRequestLogging              = "f5.io/request-logging"
+	AnnotationRequestLoggingSampleRate    = "f5.io/request-logging-sample-rate"
+	AnnotationRequestLoggingRedactHeaders = "f5.io/request-logging-redact-headers"
+	AnnotationRequestLoggingHSLPool       = "f5.io/request-logging-hsl-pool"
+)
+
+// The annotations of the Service which configure the health monitor of its pool.
+// Without them, the monitor follows the readiness probe of the pods.
+const (
+	AnnotationMonitorType           = "f5.io/monitor-type"
+	AnnotationMonitorSend           = "f5.io/monitor-send"
+	AnnotationMonitorReceive        = "f5.io/monitor-receive"
+	AnnotationMonitorInterval       = "f5.io/monitor-interval"
+	AnnotationMonitorTimeout        = "f5.io/monitor-timeout"
+	AnnotationMonitorExpectedStatus = "f5.io/monitor-expected-status"
+)
+
+// The annotations of the Service which turn on the TLS from BIG-IP to its pods.
+// The CA certificate is referred as "ConfigMap/<name>" or "Secret/<name>" with the key
+// "ca.crt", the client certificate is a kubernetes.io/tls Secret, both in the namespace of the Service.
+const (
+	AnnotationBackendTLSHostname          = "f5.io/backend-tls-hostname"
+	AnnotationBackendTLSCACertificate     = "f5.io/backend-tls-ca-certificate"
+	AnnotationBackendTLSClientCertificate = "f5.io/backend-tls-client-certificate"
+)
+
+// The annotations of the Service which configure the load balancing of its pool,
+// and the persistence of the HTTPRoutes routing to it.
+const (
+	AnnotationLBMethod              = "f5.io/lb-method"
+	AnnotationSlowRampTime          = "f5.io/slow-ramp-time"
+	AnnotationConnectionLimit       = "f5.io/connection-limit"
+	AnnotationRateLimit             = "f5.io/rate-limit"
+	AnnotationPersistence           = "f5.io/persistence"
+	AnnotationPersistenceCookieName = "f5.io/persistence-cookie-name"
+	AnnotationPersistenceTimeout    = "f5.io/persistence-timeout"
+)
+
+// The annotations of the Gateway which configure the source address translation of its virtuals.
+const (
+	AnnotationSNAT          = "f5.io/snat"
+	AnnotationSNATAddresses = "f5.io/snat-addresses"
+)
+
+// The group, version and kind of the parameters referred by GatewayClass.spec.parametersRef.
+const (
+	ClassParametersGroup   = "gateway.f5.io"
+	ClassParametersVersion = "v1"
+	ClassParametersKind    = "BIGIPGatewayClassParameters"
+)
+
+// The retry policy and the circuit breaker of the deploy worker of each BIG-IP.
+// A failed request is requeued with backoff, and reported in the DeployError
+// for the object to requeue once given up.
+const (
+	DeployMaxRetries     = 8
+	DeployRetryBaseDelay = 2 * time.Second
+	DeployRetryMaxDelay  = 2 * time.Minute
+	BreakerThreshold     = 5
+	BreakerCooldown      = 30 * time.Second
 )
@@ -126,31 +126,58 @@ def curl_verify(name, req, expected_resp):
     expected_status = expected_resp.get('status_code', 200)
     expected_headers = expected_resp.get('headers', {}) 
     expected_body = expected_resp.get('body', {})
+    # the requests are repeated in one session, keeping the cookies, and the
+    # sticky field of the response body must be the same for all of them.
+    repeat = req.get('repeat', 1)
+    sticky = expected_resp.get('sticky', None)
+    stuck = None
     try:
-        warn(name, "requesting: %s" % req)
-        resp = requests.request(method=method, url="%s" % url, params=queries, headers=headers, json=body, allow_redirects=False, timeout=2)
-        try:
-            resp_headers = dict(resp.headers)
-            if type(expected_body) == type({}):
-                resp_body = resp.json()
-            else:
-                resp_body = resp.text
-        except Exception as e:
-            return False, "Response format unexpected: not json-formated(%s)" % e
-
-        if resp.status_code != expected_status:
-            return False, "Status code unexpected: expected: %d, actually: %d" % (expected_status, resp.status_code)
-        if not json_is_included_expectedly(expected_headers, resp_headers):
-            return False, "Header unexpected: expected %s, actually %s " % (expected_headers, resp_headers)
-        
-        if not json_is_included_expectedly(expected_body, resp_body):
-            return False, "Response body unexpected: expected %s, actually %s" % (expected_body, resp_body)
+        session = requests.Session()
+        for i in range(repeat):
+            warn(name, "requesting: %s" % req)
+            resp = session.request(method=method, url="%s" % url, params=queries, headers=headers, json=body, allow_redirects=False, timeout=2)
+            try:
+                resp_headers = dict(resp.headers)
+                if type(expected_body) == type({}):
+                    resp_body = resp.json()
+                else:
+                    resp_body = resp.text
+            except Exception as e:
+                return False, "Response format unexpected: not json-formated(%s)" % e
+
+            if resp.status_code != expected_status:
+                return False, "Status code unexpected: expected: %d, actually: %d" % (expected_status, resp.status_code)
+            if not json_is_included_expectedly(expected_headers, resp_headers):
+                return False, "Header unexpected: expected %s, actually %s " % (expected_headers, resp_headers)
+            
+            if not json_is_included_expectedly(expected_body, resp_body):
+                return False, "Response body unexpected: expected %s, actually %s" % (expected_body, resp_body)
+
+            if sticky is not None:
+                if i == 0:
+                    stuck = resp_body.get(sticky)
+                elif resp_body.get(sticky) != stuck:
+                    return False, "Not sticky: %s changed from %s to %s" % (sticky, stuck, resp_body.get(sticky))
 
     except Exception as e:
         return False, "failed to %s to %s: %s" % (method, url, e)
     else:
         return True, "Successfully verified %s via %s %s" % (name, method, url)
 
+# the mirrored requests are answered to no one, they are verified by the
+# access logs of the pods of the mirror backend instead.
+def mirror_verify(name, expected_mirror):
+    selector = expected_mirror['selector']
+    logged = expected_mirror['logged']
+    cmd = "kubectl --kubeconfig %s logs -l %s --tail=-1" % (os.environ['KUBE_CONFIG_FILEPATH'], selector)
+    warn(name, "checking mirror: %s" % cmd)
+    cp = subprocess.run(cmd, shell=True, stderr=subprocess.PIPE, stdout=subprocess.PIPE)
+    if cp.returncode != 0:
+        return False, "Failed to get logs of %s: %s" % (selector, str(cp.stderr, 'utf-8'))
+    if logged not in str(cp.stdout, 'utf-8'):
+        return False, "Not mirrored: '%s' not found in logs of %s" % (logged, selector)
+    return True, "Successfully verified %s mirrored to %s" % (name, selector)
+
 
 class test_context():
     def __init__(self, name, ctx_yamls) -> None:
@@ -176,6 +203,8 @@ for case in testcases:
         retries = 50
         for t in range(retries):
             (passed, msg)  = curl_verify(n, case['request'], case['response'])
+            if passed and 'mirrored' in case:
+                (passed, msg) = mirror_verify(n, case['mirrored'])
             if not passed:
                 time.sleep(2)
                 warn(n, msg)